@@ -0,0 +1,172 @@
+package bloom
+
+import (
+	"math"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/zentures/cityhash"
+)
+
+const (
+	blockBits  = 512 // one 64-byte cache line
+	blockWords = blockBits / 64
+)
+
+// BlockedFilter is a cache-line blocked Bloom filter. CityHash64WithSeed
+// picks one 64-byte block per key and all k probe bits fall inside it, so a
+// lookup touches a single cache line. For the same false positive rate it
+// needs somewhat more space than Filter.
+//
+// Add and Test are not safe for concurrent use; AddAtomic and TestAtomic may
+// be called from any number of goroutines at once.
+type BlockedFilter struct {
+	blocks uint64
+	k      uint32
+	seed   uint64
+	words  []uint64 // blocks*blockWords words starting on a cache line
+}
+
+// NewBlocked returns a blocked filter sized for n items at a false positive
+// rate of about p.
+func NewBlocked(n uint64, p float64) *BlockedFilter {
+	return NewBlockedWithSeed(n, p, DefaultSeed.Lower64())
+}
+
+// NewBlockedWithSeed is like NewBlocked but hashes keys with the given seed.
+func NewBlockedWithSeed(n uint64, p float64, seed uint64) *BlockedFilter {
+	m, k := Estimate(n, p)
+
+	// Keys don't spread evenly over the blocks, which costs roughly a fifth
+	// more bits at the usual error rates.
+	m = uint64(math.Ceil(float64(m) * 1.2))
+	return NewBlockedWithSize((m+blockBits-1)/blockBits, k, seed)
+}
+
+// NewBlockedWithSize returns a blocked filter of the given number of 512-bit
+// blocks and k probes per key.
+func NewBlockedWithSize(blocks uint64, k uint32, seed uint64) *BlockedFilter {
+	if blocks == 0 {
+		blocks = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+
+	return &BlockedFilter{
+		blocks: blocks,
+		k:      k,
+		seed:   seed,
+		words:  alignedWords(blocks * blockWords),
+	}
+}
+
+// alignedWords returns n zeroed words starting on a 64-byte boundary.
+func alignedWords(n uint64) []uint64 {
+	words := make([]uint64, n+blockWords-1)
+	off := (64 - uintptr(unsafe.Pointer(&words[0]))%64) % 64 / 8
+	return words[off : off+uintptr(n) : off+uintptr(n)]
+}
+
+func (this *BlockedFilter) Cap() uint64 {
+	return this.blocks * blockBits
+}
+
+func (this *BlockedFilter) K() uint32 {
+	return this.k
+}
+
+func (this *BlockedFilter) Seed() uint64 {
+	return this.seed
+}
+
+// block returns the block of key and the bits its probe offsets are drawn
+// from. The high half of the hash picks the block; a bijective remix of all
+// of it supplies 9-bit offsets inside the block, seven per 64 bits.
+func (this *BlockedFilter) block(key []byte) ([]uint64, uint64) {
+	h := cityhash.CityHash64WithSeed(key, uint32(len(key)), this.seed)
+	i := ((h >> 32) * this.blocks) >> 32
+	return this.words[i*blockWords : (i+1)*blockWords], h * 0x9e3779b97f4a7c15
+}
+
+// probe returns the offset of probe i within its block, remixing g once its
+// bits have been used up.
+func probe(g *uint64, i uint32) uint64 {
+	j := i % 7
+	if j == 0 && i > 0 {
+		*g = (*g ^ *g>>31) * 0xbf58476d1ce4e5b9
+	}
+	return (*g >> (55 - 9*j)) & (blockBits - 1)
+}
+
+func (this *BlockedFilter) Add(key []byte) {
+	block, g := this.block(key)
+	for i := uint32(0); i < this.k; i++ {
+		bit := probe(&g, i)
+		block[bit>>6] |= 1 << (bit & 63)
+	}
+}
+
+// Test reports whether key may have been added. False means it definitely
+// has not.
+func (this *BlockedFilter) Test(key []byte) bool {
+	block, g := this.block(key)
+	for i := uint32(0); i < this.k; i++ {
+		bit := probe(&g, i)
+		if block[bit>>6]&(1<<(bit&63)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// AddAtomic is like Add but safe to call concurrently with AddAtomic and
+// TestAtomic.
+func (this *BlockedFilter) AddAtomic(key []byte) {
+	block, g := this.block(key)
+	for i := uint32(0); i < this.k; i++ {
+		bit := probe(&g, i)
+		word, mask := &block[bit>>6], uint64(1)<<(bit&63)
+		for {
+			old := atomic.LoadUint64(word)
+			if old&mask != 0 || atomic.CompareAndSwapUint64(word, old, old|mask) {
+				break
+			}
+		}
+	}
+}
+
+// TestAtomic is like Test but safe to call concurrently with AddAtomic.
+func (this *BlockedFilter) TestAtomic(key []byte) bool {
+	block, g := this.block(key)
+	for i := uint32(0); i < this.k; i++ {
+		bit := probe(&g, i)
+		if atomic.LoadUint64(&block[bit>>6])&(1<<(bit&63)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Compatible reports whether other has the same size, probe count and seed.
+func (this *BlockedFilter) Compatible(other *BlockedFilter) bool {
+	return this.blocks == other.blocks && this.k == other.k && this.seed == other.seed
+}
+
+// Union adds all items of other to this filter.
+func (this *BlockedFilter) Union(other *BlockedFilter) error {
+	if !this.Compatible(other) {
+		return ErrIncompatible
+	}
+
+	for i, w := range other.words {
+		this.words[i] |= w
+	}
+	return nil
+}
+
+func (this *BlockedFilter) Clear() {
+	for i := range this.words {
+		this.words[i] = 0
+	}
+}
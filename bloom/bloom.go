@@ -0,0 +1,180 @@
+// Package bloom implements Bloom filters keyed by CityHash128WithSeed.
+//
+// The k bit indexes of a key are derived from the two 64-bit halves h1, h2 of
+// a single CityHash128WithSeed call as h1 + i*h2 (mod m), for i < k, after
+// Kirsch and Mitzenmacher, "Less Hashing, Same Performance".
+package bloom
+
+import (
+	"math"
+
+	"github.com/zentures/cityhash"
+)
+
+// DefaultSeed is the seed used by New. It is the seed CityHash128 itself
+// uses for short inputs.
+var DefaultSeed = cityhash.Uint128{0xc3a5c85c97cb3127, 0xb492b66fbe98f273}
+
+// Filter is a classic Bloom filter of m bits and k hash functions. It is not
+// safe for concurrent use.
+type Filter struct {
+	m    uint64
+	k    uint32
+	seed cityhash.Uint128
+	bits []uint64
+}
+
+// Estimate returns the number of bits m and hash functions k a filter needs
+// to hold n items with a false positive rate of p. The rate must be in
+// (0, 1): a rate of 1 or more (or NaN) gives the smallest filter, and a rate
+// of 0 or less is taken as the smallest positive float64.
+func Estimate(n uint64, p float64) (m uint64, k uint32) {
+	if n == 0 {
+		n = 1
+	}
+	if !(p < 1) {
+		return 1, 1
+	}
+	if p <= 0 {
+		p = math.SmallestNonzeroFloat64
+	}
+
+	bits := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	switch {
+	case bits < 1:
+		m = 1
+	case bits >= 1<<63:
+		m = 1 << 63
+	default:
+		m = uint64(bits)
+	}
+
+	k = uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+
+	return m, k
+}
+
+// New returns a filter sized for n items at a false positive rate of p.
+func New(n uint64, p float64) *Filter {
+	return NewWithSeed(n, p, DefaultSeed)
+}
+
+// NewWithSeed is like New but hashes keys with the given seed. Only filters
+// with equal seeds can be combined.
+func NewWithSeed(n uint64, p float64, seed cityhash.Uint128) *Filter {
+	m, k := Estimate(n, p)
+	return NewWithSize(m, k, seed)
+}
+
+// NewWithSize returns a filter of m bits and k hash functions.
+func NewWithSize(m uint64, k uint32, seed cityhash.Uint128) *Filter {
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+
+	return &Filter{
+		m:    m,
+		k:    k,
+		seed: seed,
+		bits: make([]uint64, (m+63)/64),
+	}
+}
+
+func (this *Filter) Cap() uint64 {
+	return this.m
+}
+
+func (this *Filter) K() uint32 {
+	return this.k
+}
+
+func (this *Filter) Seed() cityhash.Uint128 {
+	return this.seed
+}
+
+// location returns the double hashing pair for key.
+func location(key []byte, seed cityhash.Uint128) (uint64, uint64) {
+	h := cityhash.CityHash128WithSeed(key, uint32(len(key)), seed)
+	return h.Lower64(), h.Higher64()
+}
+
+func (this *Filter) Add(key []byte) {
+	h1, h2 := location(key, this.seed)
+	this.add(h1, h2)
+}
+
+func (this *Filter) add(h1, h2 uint64) {
+	for i := uint64(0); i < uint64(this.k); i++ {
+		idx := (h1 + i*h2) % this.m
+		this.bits[idx>>6] |= 1 << (idx & 63)
+	}
+}
+
+// Test reports whether key may have been added. False means it definitely
+// has not.
+func (this *Filter) Test(key []byte) bool {
+	h1, h2 := location(key, this.seed)
+	return this.test(h1, h2)
+}
+
+func (this *Filter) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < uint64(this.k); i++ {
+		idx := (h1 + i*h2) % this.m
+		if this.bits[idx>>6]&(1<<(idx&63)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestAndAdd reports whether key may have been added before and adds it.
+func (this *Filter) TestAndAdd(key []byte) bool {
+	h1, h2 := location(key, this.seed)
+	present := this.test(h1, h2)
+	this.add(h1, h2)
+	return present
+}
+
+// Compatible reports whether other has the same size, hash count and seed,
+// and so can be combined with this filter.
+func (this *Filter) Compatible(other *Filter) bool {
+	return this.m == other.m && this.k == other.k && this.seed == other.seed
+}
+
+// Union adds all items of other to this filter.
+func (this *Filter) Union(other *Filter) error {
+	if !this.Compatible(other) {
+		return ErrIncompatible
+	}
+
+	for i, w := range other.bits {
+		this.bits[i] |= w
+	}
+	return nil
+}
+
+// Intersect keeps only the bits set in both filters. The result may report
+// more false positives than a filter built from the intersection directly.
+func (this *Filter) Intersect(other *Filter) error {
+	if !this.Compatible(other) {
+		return ErrIncompatible
+	}
+
+	for i, w := range other.bits {
+		this.bits[i] &= w
+	}
+	return nil
+}
+
+// Clear removes all items.
+func (this *Filter) Clear() {
+	for i := range this.bits {
+		this.bits[i] = 0
+	}
+}
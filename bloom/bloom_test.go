@@ -0,0 +1,405 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/zentures/cityhash"
+)
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("key-%d", i))
+}
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+	const p = 0.01
+
+	f := New(n, p)
+	for i := 0; i < n; i++ {
+		f.Add(key(i))
+	}
+
+	for i := 0; i < n; i++ {
+		if !f.Test(key(i)) {
+			t.Fatalf("ERROR: false negative for %s", key(i))
+		}
+	}
+
+	fp := 0
+	for i := n; i < 2*n; i++ {
+		if f.Test(key(i)) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / n; rate > 2*p {
+		t.Errorf("ERROR: expected a false positive rate near %v but got %v", p, rate)
+	}
+
+	// Rates outside (0, 1) are clamped rather than sizing a filter from
+	// infinite or negative bit counts.
+	for _, p := range []float64{0, -0.1, 1, 1.5, math.NaN()} {
+		f := New(100, p)
+		f.Add(key(0))
+		if !f.Test(key(0)) {
+			t.Errorf("ERROR: p=%v: false negative", p)
+		}
+	}
+	if m, k := Estimate(100, 1.5); m != 1 || k != 1 {
+		t.Errorf("ERROR: expected the smallest filter for p >= 1 but got m=%d, k=%d", m, k)
+	}
+}
+
+func TestFilterUnionIntersect(t *testing.T) {
+	a, b := New(1000, 0.001), New(1000, 0.001)
+	for i := 0; i < 100; i++ {
+		a.Add(key(i))
+		b.Add(key(i + 50))
+	}
+
+	u := New(1000, 0.001)
+	u.Union(a)
+	if err := u.Union(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 150; i++ {
+		if !u.Test(key(i)) {
+			t.Errorf("ERROR: union is missing %s", key(i))
+		}
+	}
+
+	if err := a.Intersect(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := 50; i < 100; i++ {
+		if !a.Test(key(i)) {
+			t.Errorf("ERROR: intersection is missing %s", key(i))
+		}
+	}
+
+	if err := a.Union(NewWithSeed(1000, 0.001, cityhash.Uint128{1, 2})); err != ErrIncompatible {
+		t.Errorf("ERROR: expected ErrIncompatible for different seeds but got %v", err)
+	}
+	if err := a.Union(New(2000, 0.001)); err != ErrIncompatible {
+		t.Errorf("ERROR: expected ErrIncompatible for different sizes but got %v", err)
+	}
+}
+
+func TestFilterEncoding(t *testing.T) {
+	f := NewWithSeed(500, 0.01, cityhash.Uint128{7, 9})
+	for i := 0; i < 500; i++ {
+		f.Add(key(i))
+	}
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var g Filter
+	if err = g.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Compatible(f) {
+		t.Fatalf("ERROR: expected the decoded filter to match the original")
+	}
+	for i := 0; i < 1000; i++ {
+		if f.Test(key(i)) != g.Test(key(i)) {
+			t.Errorf("ERROR: decoded filter disagrees on %s", key(i))
+		}
+	}
+
+	if err = g.UnmarshalBinary(b[:len(b)-1]); err != ErrInvalid {
+		t.Errorf("ERROR: expected ErrInvalid for a truncated filter but got %v", err)
+	}
+
+	// An m that would overflow when rounded up to words must not decode.
+	huge := header{kind: kindClassic, k: 3, m: math.MaxUint64 - 10}.append(nil)
+	if err = g.UnmarshalBinary(huge); err != ErrInvalid {
+		t.Errorf("ERROR: expected ErrInvalid for m near 2^64 but got %v", err)
+	}
+}
+
+func TestBlockedFilter(t *testing.T) {
+	const n = 10000
+	const p = 0.01
+
+	f := NewBlocked(n, p)
+	if addr := uintptr(unsafe.Pointer(&f.words[0])); addr%64 != 0 {
+		t.Errorf("ERROR: expected blocks to start on a cache line but got address 0x%x", addr)
+	}
+
+	for i := 0; i < n; i++ {
+		f.Add(key(i))
+	}
+
+	fp := 0
+	for i := 0; i < 2*n; i++ {
+		if ok := f.Test(key(i)); i < n && !ok {
+			t.Fatalf("ERROR: false negative for %s", key(i))
+		} else if i >= n && ok {
+			fp++
+		}
+	}
+	if rate := float64(fp) / n; rate > 2*p {
+		t.Errorf("ERROR: expected a false positive rate near %v but got %v", p, rate)
+	}
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g BlockedFilter
+	if err = g.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Compatible(f) {
+		t.Fatalf("ERROR: expected the decoded filter to match the original")
+	}
+	for i := 0; i < 2*n; i++ {
+		if f.Test(key(i)) != g.Test(key(i)) {
+			t.Fatalf("ERROR: decoded filter disagrees on %s", key(i))
+		}
+	}
+}
+
+func TestBlockedFilterAtomic(t *testing.T) {
+	const n = 20000
+
+	f := NewBlocked(n, 0.01)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += 4 {
+				f.AddAtomic(key(i))
+				f.TestAtomic(key(i + 1))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if !f.TestAtomic(key(i)) {
+			t.Fatalf("ERROR: false negative for %s", key(i))
+		}
+	}
+}
+
+const benchItems = 1 << 22
+
+var benchKeys = func() [][]byte {
+	keys := make([][]byte, 1<<16)
+	for i := range keys {
+		keys[i] = key(i * 7919)
+	}
+	return keys
+}()
+
+func fill(add func([]byte)) {
+	for i := 0; i < benchItems; i += 64 {
+		add(key(i))
+	}
+}
+
+func BenchmarkFilterTest(b *testing.B) {
+	f := New(benchItems, 0.01)
+	fill(f.Add)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		f.Test(benchKeys[i&(len(benchKeys)-1)])
+	}
+}
+
+func BenchmarkBlockedFilterTest(b *testing.B) {
+	f := NewBlocked(benchItems, 0.01)
+	fill(f.Add)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		f.Test(benchKeys[i&(len(benchKeys)-1)])
+	}
+}
+
+func BenchmarkFilterAdd(b *testing.B) {
+	f := New(benchItems, 0.01)
+
+	for i := 0; i < b.N; i++ {
+		f.Add(benchKeys[i&(len(benchKeys)-1)])
+	}
+}
+
+func BenchmarkBlockedFilterAdd(b *testing.B) {
+	f := NewBlocked(benchItems, 0.01)
+
+	for i := 0; i < b.N; i++ {
+		f.Add(benchKeys[i&(len(benchKeys)-1)])
+	}
+}
+
+func BenchmarkBlockedFilterAddAtomic(b *testing.B) {
+	f := NewBlocked(benchItems, 0.01)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			f.AddAtomic(benchKeys[i&(len(benchKeys)-1)])
+		}
+	})
+}
+
+func TestCountingFilter(t *testing.T) {
+	const n = 5000
+
+	f := NewCounting(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add(key(i))
+	}
+	for i := 0; i < n; i += 2 {
+		if !f.Remove(key(i)) {
+			t.Fatalf("ERROR: expected %s to be present", key(i))
+		}
+	}
+
+	present := 0
+	for i := 0; i < n; i++ {
+		ok := f.Test(key(i))
+		if i%2 == 1 && !ok {
+			t.Fatalf("ERROR: false negative for %s", key(i))
+		}
+		if i%2 == 0 && ok {
+			present++
+		}
+	}
+	if present > n/50 {
+		t.Errorf("ERROR: expected removed keys to be gone but %d still test positive", present)
+	}
+
+	// Saturated counters are never decremented, so the key stays.
+	g := NewCountingWithSize(64, 3, DefaultSeed)
+	for i := 0; i < 20; i++ {
+		g.Add(key(0))
+	}
+	for i := 0; i < 20; i++ {
+		g.Remove(key(0))
+	}
+	if !g.Test(key(0)) {
+		t.Errorf("ERROR: expected saturated counters to keep %s", key(0))
+	}
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d CountingFilter
+	if err = d.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if f.Test(key(i)) != d.Test(key(i)) {
+			t.Fatalf("ERROR: decoded filter disagrees on %s", key(i))
+		}
+	}
+	var c Filter
+	if err = c.UnmarshalBinary(b); err != ErrInvalid {
+		t.Errorf("ERROR: expected ErrInvalid decoding a counting filter as a classic one but got %v", err)
+	}
+
+	huge := header{kind: kindCounting, k: 3, m: math.MaxUint64 - 10}.append(nil)
+	if err = d.UnmarshalBinary(huge); err != ErrInvalid {
+		t.Errorf("ERROR: expected ErrInvalid for m near 2^64 but got %v", err)
+	}
+}
+
+func TestScalableFilter(t *testing.T) {
+	const n = 20000
+	const p = 0.01
+
+	f := NewScalable(100, p)
+	for i := 0; i < n; i++ {
+		f.Add(key(i))
+	}
+	if f.Slices() < 5 {
+		t.Errorf("ERROR: expected the filter to grow but it has %d slices", f.Slices())
+	}
+
+	fp := 0
+	for i := 0; i < 2*n; i++ {
+		if ok := f.Test(key(i)); i < n && !ok {
+			t.Fatalf("ERROR: false negative for %s", key(i))
+		} else if i >= n && ok {
+			fp++
+		}
+	}
+	if rate := float64(fp) / n; rate > p {
+		t.Errorf("ERROR: expected a false positive rate below %v but got %v", p, rate)
+	}
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g ScalableFilter
+	if err = g.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*n; i++ {
+		if f.Test(key(i)) != g.Test(key(i)) {
+			t.Fatalf("ERROR: decoded filter disagrees on %s", key(i))
+		}
+	}
+
+	// The decoded filter carries on growing where the original left off.
+	for i := n; i < 2*n; i++ {
+		f.Add(key(i))
+		g.Add(key(i))
+	}
+	if f.Slices() != g.Slices() {
+		t.Errorf("ERROR: expected %d slices but got %d", f.Slices(), g.Slices())
+	}
+
+	if err = g.UnmarshalBinary(b[:len(b)-3]); err != ErrInvalid {
+		t.Errorf("ERROR: expected ErrInvalid for a truncated filter but got %v", err)
+	}
+
+	// A slice whose m would overflow is rejected like a classic filter.
+	slice := header{kind: kindClassic, k: 3, m: math.MaxUint64 - 10, seed: DefaultSeed}.append(nil)
+	bad := header{kind: kindScalable, k: 1, m: math.MaxUint64 - 10, seed: DefaultSeed}.append(nil)
+	bad = append(bad, b[headerSize:headerSize+scalableSize]...)
+	bad = binary.LittleEndian.AppendUint64(bad, uint64(len(slice)))
+	bad = append(bad, slice...)
+	if err = g.UnmarshalBinary(bad); err != ErrInvalid {
+		t.Errorf("ERROR: expected ErrInvalid for an oversized slice but got %v", err)
+	}
+
+	// Parameters that would make the filter grow without bound or size
+	// slices from a broken error rate are rejected too.
+	fields := headerSize
+	for name, corrupt := range map[string]func(b []byte){
+		"growth 0":       func(b []byte) { binary.LittleEndian.PutUint32(b[fields+16:], 0) },
+		"tightening 1":   func(b []byte) { binary.LittleEndian.PutUint64(b[fields+8:], math.Float64bits(1)) },
+		"tightening NaN": func(b []byte) { binary.LittleEndian.PutUint64(b[fields+8:], math.Float64bits(math.NaN())) },
+		"p 0":            func(b []byte) { binary.LittleEndian.PutUint64(b[fields:], 0) },
+		"p 1.5":          func(b []byte) { binary.LittleEndian.PutUint64(b[fields:], math.Float64bits(1.5)) },
+		"capacity 0":     func(b []byte) { binary.LittleEndian.PutUint64(b[fields+24:], 0) },
+		"count":          func(b []byte) { binary.LittleEndian.PutUint64(b[fields+32:], math.MaxUint64) },
+	} {
+		c := append([]byte(nil), b...)
+		corrupt(c)
+		if err = g.UnmarshalBinary(c); err != ErrInvalid {
+			t.Errorf("ERROR: %s: expected ErrInvalid but got %v", name, err)
+		}
+	}
+
+	// Out-of-range tightening falls back to the default.
+	for _, r := range []float64{0, 1, 1.5, math.NaN()} {
+		if s := NewScalableWithSeed(10, p, 2, r, DefaultSeed); s.tightening != DefaultTightening {
+			t.Errorf("ERROR: tightening %v: expected %v but got %v", r, DefaultTightening, s.tightening)
+		}
+	}
+}
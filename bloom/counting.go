@@ -0,0 +1,121 @@
+package bloom
+
+import (
+	"github.com/zentures/cityhash"
+)
+
+const counterMax = 15
+
+// CountingFilter is a Bloom filter of 4-bit saturating counters, which lets
+// items be removed again. A counter that reaches 15 stays there, since its
+// true count is no longer known. It is not safe for concurrent use.
+type CountingFilter struct {
+	m        uint64
+	k        uint32
+	seed     cityhash.Uint128
+	counters []uint64 // 16 counters per word
+}
+
+// NewCounting returns a counting filter sized for n items at a false
+// positive rate of p.
+func NewCounting(n uint64, p float64) *CountingFilter {
+	return NewCountingWithSeed(n, p, DefaultSeed)
+}
+
+// NewCountingWithSeed is like NewCounting but hashes keys with the given seed.
+func NewCountingWithSeed(n uint64, p float64, seed cityhash.Uint128) *CountingFilter {
+	m, k := Estimate(n, p)
+	return NewCountingWithSize(m, k, seed)
+}
+
+// NewCountingWithSize returns a counting filter of m counters and k hash
+// functions.
+func NewCountingWithSize(m uint64, k uint32, seed cityhash.Uint128) *CountingFilter {
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+
+	return &CountingFilter{
+		m:        m,
+		k:        k,
+		seed:     seed,
+		counters: make([]uint64, (m+15)/16),
+	}
+}
+
+func (this *CountingFilter) Cap() uint64 {
+	return this.m
+}
+
+func (this *CountingFilter) K() uint32 {
+	return this.k
+}
+
+func (this *CountingFilter) Seed() cityhash.Uint128 {
+	return this.seed
+}
+
+func (this *CountingFilter) counter(idx uint64) uint64 {
+	return (this.counters[idx>>4] >> ((idx & 15) * 4)) & counterMax
+}
+
+func (this *CountingFilter) addCounter(idx uint64, delta int) {
+	this.counters[idx>>4] += uint64(delta) << ((idx & 15) * 4)
+}
+
+func (this *CountingFilter) Add(key []byte) {
+	h1, h2 := location(key, this.seed)
+	for i := uint64(0); i < uint64(this.k); i++ {
+		idx := (h1 + i*h2) % this.m
+		if this.counter(idx) < counterMax {
+			this.addCounter(idx, 1)
+		}
+	}
+}
+
+// Test reports whether key may have been added and not removed since.
+func (this *CountingFilter) Test(key []byte) bool {
+	h1, h2 := location(key, this.seed)
+	return this.test(h1, h2)
+}
+
+func (this *CountingFilter) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < uint64(this.k); i++ {
+		if this.counter((h1+i*h2)%this.m) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove removes one copy of key and reports whether key may have been
+// present. Removing a key that was never added can remove other keys, so
+// only remove what was added.
+func (this *CountingFilter) Remove(key []byte) bool {
+	h1, h2 := location(key, this.seed)
+	if !this.test(h1, h2) {
+		return false
+	}
+
+	for i := uint64(0); i < uint64(this.k); i++ {
+		idx := (h1 + i*h2) % this.m
+		if c := this.counter(idx); c > 0 && c < counterMax {
+			this.addCounter(idx, -1)
+		}
+	}
+	return true
+}
+
+// Compatible reports whether other has the same size, hash count and seed.
+func (this *CountingFilter) Compatible(other *CountingFilter) bool {
+	return this.m == other.m && this.k == other.k && this.seed == other.seed
+}
+
+func (this *CountingFilter) Clear() {
+	for i := range this.counters {
+		this.counters[i] = 0
+	}
+}
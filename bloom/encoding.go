@@ -0,0 +1,259 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/zentures/cityhash"
+)
+
+// All filters in this package serialize to the same format, little endian
+// throughout:
+//
+//	magic   [4]byte "CHBF"
+//	version uint8   1
+//	kind    uint8   see below
+//	        [2]byte reserved, zero
+//	k       uint32
+//	m       uint64
+//	seed    [2]uint64 Lower64, Higher64
+//	payload
+//
+// The payload of a classic filter (kind 1) is the bit array as ceil(m/64)
+// uint64 words, bit i being bit i%64 of word i/64. A blocked filter (kind 2)
+// has the same payload; m is a multiple of 512 and its 64-bit seed is stored
+// as Lower64.
+//
+// The payload of a counting filter (kind 3) is ceil(m/16) uint64 words of
+// 4-bit counters, counter i being bits 4*(i%16) to 4*(i%16)+3 of word i/16.
+//
+// A scalable filter (kind 4) stores the number of slices as k and their
+// total size as m. Its payload is
+//
+//	p          float64 overall false positive rate
+//	tightening float64
+//	growth     uint32
+//	           [4]byte reserved, zero
+//	capacity   uint64  items the newest slice is sized for
+//	count      uint64  items in the newest slice
+//
+// followed by each slice, oldest first, as a uint64 length and the encoding
+// of a classic filter.
+const (
+	headerSize = 36
+
+	encodingVersion = 1
+
+	kindClassic  = 1
+	kindBlocked  = 2
+	kindCounting = 3
+	kindScalable = 4
+	scalableSize = 40
+)
+
+var (
+	ErrIncompatible = errors.New("bloom: incompatible filters")
+	ErrInvalid      = errors.New("bloom: invalid encoding")
+)
+
+var magic = [4]byte{'C', 'H', 'B', 'F'}
+
+type header struct {
+	kind uint8
+	k    uint32
+	m    uint64
+	seed cityhash.Uint128
+}
+
+func (this header) append(b []byte) []byte {
+	b = append(b, magic[:]...)
+	b = append(b, encodingVersion, this.kind, 0, 0)
+	b = binary.LittleEndian.AppendUint32(b, this.k)
+	b = binary.LittleEndian.AppendUint64(b, this.m)
+	b = binary.LittleEndian.AppendUint64(b, this.seed.Lower64())
+	b = binary.LittleEndian.AppendUint64(b, this.seed.Higher64())
+	return b
+}
+
+// decodeHeader parses a header of the given kind and returns the payload.
+func decodeHeader(b []byte, kind uint8) (header, []byte, error) {
+	var h header
+	if len(b) < headerSize || [4]byte(b[:4]) != magic || b[4] != encodingVersion || b[5] != kind {
+		return h, nil, ErrInvalid
+	}
+
+	h.kind = kind
+	h.k = binary.LittleEndian.Uint32(b[8:])
+	h.m = binary.LittleEndian.Uint64(b[12:])
+	h.seed = cityhash.Uint128{binary.LittleEndian.Uint64(b[20:]), binary.LittleEndian.Uint64(b[28:])}
+	if h.k == 0 || h.m == 0 {
+		return h, nil, ErrInvalid
+	}
+
+	return h, b[headerSize:], nil
+}
+
+func appendWords(b []byte, words []uint64) []byte {
+	for _, w := range words {
+		b = binary.LittleEndian.AppendUint64(b, w)
+	}
+	return b
+}
+
+func decodeWords(b []byte, n uint64) ([]uint64, []byte, error) {
+	if uint64(len(b))/8 < n {
+		return nil, nil, ErrInvalid
+	}
+
+	words := make([]uint64, n)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(b[8*i:])
+	}
+	return words, b[8*n:], nil
+}
+
+func (this *Filter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, headerSize+8*len(this.bits))
+	b = header{kind: kindClassic, k: this.k, m: this.m, seed: this.seed}.append(b)
+	return appendWords(b, this.bits), nil
+}
+
+func (this *Filter) UnmarshalBinary(b []byte) error {
+	h, payload, err := decodeHeader(b, kindClassic)
+	if err != nil {
+		return err
+	}
+
+	// Bound m by the payload before rounding it up, which could overflow.
+	if h.m > 64*uint64(len(payload)/8) {
+		return ErrInvalid
+	}
+	bits, rest, err := decodeWords(payload, (h.m+63)/64)
+	if err != nil || len(rest) != 0 {
+		return ErrInvalid
+	}
+
+	*this = Filter{m: h.m, k: h.k, seed: h.seed, bits: bits}
+	return nil
+}
+
+func (this *BlockedFilter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, headerSize+8*len(this.words))
+	b = header{kind: kindBlocked, k: this.k, m: this.Cap(), seed: cityhash.Uint128{this.seed, 0}}.append(b)
+	return appendWords(b, this.words), nil
+}
+
+func (this *BlockedFilter) UnmarshalBinary(b []byte) error {
+	h, payload, err := decodeHeader(b, kindBlocked)
+	if err != nil {
+		return err
+	}
+	if h.m%blockBits != 0 {
+		return ErrInvalid
+	}
+
+	words, rest, err := decodeWords(payload, h.m/64)
+	if err != nil || len(rest) != 0 {
+		return ErrInvalid
+	}
+
+	*this = BlockedFilter{blocks: h.m / blockBits, k: h.k, seed: h.seed.Lower64(), words: alignedWords(h.m / 64)}
+	copy(this.words, words)
+	return nil
+}
+
+func (this *CountingFilter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, headerSize+8*len(this.counters))
+	b = header{kind: kindCounting, k: this.k, m: this.m, seed: this.seed}.append(b)
+	return appendWords(b, this.counters), nil
+}
+
+func (this *CountingFilter) UnmarshalBinary(b []byte) error {
+	h, payload, err := decodeHeader(b, kindCounting)
+	if err != nil {
+		return err
+	}
+
+	// As for Filter, bound m before rounding it up to whole words.
+	if h.m > 16*uint64(len(payload)/8) {
+		return ErrInvalid
+	}
+	counters, rest, err := decodeWords(payload, (h.m+15)/16)
+	if err != nil || len(rest) != 0 {
+		return ErrInvalid
+	}
+
+	*this = CountingFilter{m: h.m, k: h.k, seed: h.seed, counters: counters}
+	return nil
+}
+
+func (this *ScalableFilter) MarshalBinary() ([]byte, error) {
+	var m uint64
+	for _, s := range this.slices {
+		m += s.m
+	}
+
+	b := header{kind: kindScalable, k: uint32(len(this.slices)), m: m, seed: this.seed}.append(nil)
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(this.p))
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(this.tightening))
+	b = binary.LittleEndian.AppendUint32(b, this.growth)
+	b = append(b, 0, 0, 0, 0)
+	b = binary.LittleEndian.AppendUint64(b, this.capacity)
+	b = binary.LittleEndian.AppendUint64(b, this.count)
+
+	for _, s := range this.slices {
+		sb, _ := s.MarshalBinary()
+		b = binary.LittleEndian.AppendUint64(b, uint64(len(sb)))
+		b = append(b, sb...)
+	}
+	return b, nil
+}
+
+func (this *ScalableFilter) UnmarshalBinary(b []byte) error {
+	h, payload, err := decodeHeader(b, kindScalable)
+	if err != nil {
+		return err
+	}
+	if len(payload) < scalableSize {
+		return ErrInvalid
+	}
+
+	f := ScalableFilter{
+		p:          math.Float64frombits(binary.LittleEndian.Uint64(payload)),
+		tightening: math.Float64frombits(binary.LittleEndian.Uint64(payload[8:])),
+		growth:     binary.LittleEndian.Uint32(payload[16:]),
+		seed:       h.seed,
+		capacity:   binary.LittleEndian.Uint64(payload[24:]),
+		count:      binary.LittleEndian.Uint64(payload[32:]),
+	}
+	payload = payload[scalableSize:]
+
+	if f.growth < 1 || !(f.tightening > 0 && f.tightening < 1) || !(f.p > 0 && f.p < 1) ||
+		f.capacity == 0 || f.count > f.capacity {
+		return ErrInvalid
+	}
+
+	for i := uint32(0); i < h.k; i++ {
+		if len(payload) < 8 {
+			return ErrInvalid
+		}
+		n := binary.LittleEndian.Uint64(payload)
+		if uint64(len(payload)-8) < n {
+			return ErrInvalid
+		}
+
+		s := new(Filter)
+		if err := s.UnmarshalBinary(payload[8 : 8+n]); err != nil || s.seed != h.seed {
+			return ErrInvalid
+		}
+		f.slices = append(f.slices, s)
+		payload = payload[8+n:]
+	}
+	if len(payload) != 0 {
+		return ErrInvalid
+	}
+
+	*this = f
+	return nil
+}
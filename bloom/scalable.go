@@ -0,0 +1,101 @@
+package bloom
+
+import (
+	"math"
+
+	"github.com/zentures/cityhash"
+)
+
+const (
+	DefaultGrowth     = 2
+	DefaultTightening = 0.8
+)
+
+// ScalableFilter is a Bloom filter that grows as items are added, after
+// Almeida et al., "Scalable Bloom Filters". Once the newest slice holds as
+// many items as it was sized for, a new slice is added with Growth times the
+// capacity and Tightening times the error rate, which keeps the overall false
+// positive rate below the one asked for. All slices share one seed, so a key
+// is hashed once however many slices there are. It is not safe for
+// concurrent use.
+type ScalableFilter struct {
+	p          float64 // target false positive rate overall
+	growth     uint32
+	tightening float64
+	seed       cityhash.Uint128
+	slices     []*Filter
+	capacity   uint64 // items the newest slice is sized for
+	count      uint64 // items added to the newest slice
+}
+
+// NewScalable returns a scalable filter whose first slice holds n items and
+// whose overall false positive rate stays below p.
+func NewScalable(n uint64, p float64) *ScalableFilter {
+	return NewScalableWithSeed(n, p, DefaultGrowth, DefaultTightening, DefaultSeed)
+}
+
+// NewScalableWithSeed is like NewScalable with explicit growth and tightening
+// ratios and seed. A growth below 1 is taken as 1, and a tightening outside
+// (0, 1), which would not keep the error rates summing to p, as
+// DefaultTightening.
+func NewScalableWithSeed(n uint64, p float64, growth uint32, tightening float64, seed cityhash.Uint128) *ScalableFilter {
+	if n == 0 {
+		n = 1
+	}
+	if growth < 1 {
+		growth = 1
+	}
+	if !(tightening > 0 && tightening < 1) {
+		tightening = DefaultTightening
+	}
+
+	this := &ScalableFilter{p: p, growth: growth, tightening: tightening, seed: seed}
+	this.grow(n)
+	return this
+}
+
+// grow adds a slice for n items with the next error rate in the series
+// p(1-r), p(1-r)r, p(1-r)r^2, ... which sums to p.
+func (this *ScalableFilter) grow(n uint64) {
+	p := this.p * (1 - this.tightening) * math.Pow(this.tightening, float64(len(this.slices)))
+	this.slices = append(this.slices, NewWithSeed(n, p, this.seed))
+	this.capacity, this.count = n, 0
+}
+
+func (this *ScalableFilter) Seed() cityhash.Uint128 {
+	return this.seed
+}
+
+// Slices returns the number of slices, which starts at 1.
+func (this *ScalableFilter) Slices() int {
+	return len(this.slices)
+}
+
+// Add adds key unless it already tests positive.
+func (this *ScalableFilter) Add(key []byte) {
+	h1, h2 := location(key, this.seed)
+	if this.test(h1, h2) {
+		return
+	}
+
+	if this.count >= this.capacity {
+		this.grow(this.capacity * uint64(this.growth))
+	}
+	this.slices[len(this.slices)-1].add(h1, h2)
+	this.count++
+}
+
+// Test reports whether key may have been added.
+func (this *ScalableFilter) Test(key []byte) bool {
+	h1, h2 := location(key, this.seed)
+	return this.test(h1, h2)
+}
+
+func (this *ScalableFilter) test(h1, h2 uint64) bool {
+	for i := len(this.slices) - 1; i >= 0; i-- {
+		if this.slices[i].test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
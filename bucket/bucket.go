@@ -0,0 +1,129 @@
+// Package bucket assigns users to rollout buckets and experiments, stably and
+// without coordination.
+//
+// A user's bucket for a flag is
+//
+//	CityHash64WithSeed(flag + "\x00" + user, Seed) mod 10000
+//
+// so percentages have a granularity of 0.01%. The zero byte keeps flag "ab"
+// with user "c" apart from flag "a" with user "bc". Raising a rollout
+// percentage only adds users; nobody who was in drops out.
+package bucket
+
+import (
+	"errors"
+	"math"
+
+	"github.com/zentures/cityhash"
+)
+
+// Buckets is the number of buckets, one per 0.01%.
+const Buckets = 10000
+
+// Seed is the CityHash64WithSeed seed of every bucket computation.
+const Seed = 0x5bd1e9955bd1e995
+
+var ErrAllocation = errors.New("bucket: experiments take more than 100% of a layer")
+
+// Bucket returns the bucket of user for flag, in [0, Buckets).
+func Bucket(flag, user string) int {
+	b := make([]byte, 0, len(flag)+1+len(user))
+	b = append(b, flag...)
+	b = append(b, 0)
+	b = append(b, user...)
+	return int(cityhash.CityHash64WithSeed(b, uint32(len(b)), Seed) % Buckets)
+}
+
+// threshold converts a percentage to a number of buckets.
+func threshold(percent float64) int {
+	return int(math.Round(percent * Buckets / 100))
+}
+
+// InRollout reports whether user is among the given percentage of users that
+// have flag. Percentages are rounded to 0.01%.
+func InRollout(flag, user string, percent float64) bool {
+	return Bucket(flag, user) < threshold(percent)
+}
+
+// Experiment takes Percent of the traffic of its layer.
+type Experiment struct {
+	Name    string
+	Percent float64
+}
+
+// Layer is a set of mutually exclusive experiments: each user is in at most
+// one of them. Layers with different salts split users independently, so a
+// user can be in one experiment of every layer.
+type Layer struct {
+	salt   string
+	names  []string
+	bounds []int // cumulative bucket upper bounds, one per experiment
+}
+
+// NewLayer returns a layer whose experiments take consecutive bucket ranges
+// in the given order. To keep users in place, only append experiments or
+// grow the last one.
+func NewLayer(salt string, experiments ...Experiment) (*Layer, error) {
+	this := &Layer{salt: salt}
+
+	total := 0
+	for _, e := range experiments {
+		total += threshold(e.Percent)
+		if total > Buckets || e.Percent < 0 {
+			return nil, ErrAllocation
+		}
+		this.names = append(this.names, e.Name)
+		this.bounds = append(this.bounds, total)
+	}
+	return this, nil
+}
+
+// Assign returns the experiment user is in, or false if none.
+func (this *Layer) Assign(user string) (string, bool) {
+	b := Bucket(this.salt, user)
+	for i, bound := range this.bounds {
+		if b < bound {
+			return this.names[i], true
+		}
+	}
+	return "", false
+}
+
+// Distribution is the result of CheckDistribution.
+type Distribution struct {
+	Counts    []int   // users per bin
+	ChiSquare float64 // Pearson's statistic against equal counts
+	Z         float64 // ChiSquare as a standard normal score (Wilson-Hilferty)
+}
+
+// Uniform reports whether the counts are consistent with a uniform split,
+// that is whether Z is below 3.09 (a p-value above 0.001).
+func (this Distribution) Uniform() bool {
+	return this.Z < 3.09
+}
+
+// CheckDistribution buckets users for flag, groups the buckets into bins
+// equal ranges, and tests the counts for uniformity with a chi-square test.
+func CheckDistribution(flag string, users []string, bins int) Distribution {
+	if bins < 2 {
+		bins = 2
+	}
+
+	d := Distribution{Counts: make([]int, bins)}
+	for _, u := range users {
+		d.Counts[Bucket(flag, u)*bins/Buckets]++
+	}
+
+	// Bins can be unequal when bins does not divide Buckets.
+	for i, c := range d.Counts {
+		lo, hi := (i*Buckets+bins-1)/bins, ((i+1)*Buckets+bins-1)/bins
+		expected := float64(len(users)) * float64(hi-lo) / Buckets
+		if expected > 0 {
+			d.ChiSquare += (float64(c) - expected) * (float64(c) - expected) / expected
+		}
+	}
+
+	k := float64(bins - 1)
+	d.Z = (math.Cbrt(d.ChiSquare/k) - (1 - 2/(9*k))) / math.Sqrt(2/(9*k))
+	return d
+}
@@ -0,0 +1,115 @@
+package bucket
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func users(n int) []string {
+	u := make([]string, n)
+	for i := range u {
+		u[i] = fmt.Sprintf("user-%d", i)
+	}
+	return u
+}
+
+// Buckets must never change, or users would switch sides of a rollout.
+func TestBucket(t *testing.T) {
+	for _, f := range []struct {
+		flag, user string
+		bucket     int
+	}{
+		{"new-checkout", "user-1", 5923},
+		{"new-checkout", "user-2", 8558},
+		{"dark-mode", "42", 7782},
+	} {
+		if actual := Bucket(f.flag, f.user); actual != f.bucket {
+			t.Errorf("ERROR: %s/%s: expected bucket %d but got %d", f.flag, f.user, f.bucket, actual)
+		}
+	}
+
+	if Bucket("ab", "c") == Bucket("a", "bc") && Bucket("ab", "d") == Bucket("a", "bd") {
+		t.Errorf("ERROR: expected the flag and user to be separated")
+	}
+}
+
+func TestInRollout(t *testing.T) {
+	all := users(100000)
+
+	prev := map[string]bool{}
+	for _, percent := range []float64{0, 0.01, 1, 25, 50, 100} {
+		in := map[string]bool{}
+		for _, u := range all {
+			if InRollout("flag", u, percent) {
+				in[u] = true
+			}
+		}
+
+		if share := 100 * float64(len(in)) / float64(len(all)); math.Abs(share-percent) > 0.5 {
+			t.Errorf("ERROR: expected about %v%% of users but got %v%%", percent, share)
+		}
+		for u := range prev {
+			if !in[u] {
+				t.Errorf("ERROR: %s dropped out when the rollout grew to %v%%", u, percent)
+			}
+		}
+		prev = in
+	}
+
+	// 0.01% is one bucket.
+	for _, u := range all {
+		if InRollout("flag", u, 0.01) != (Bucket("flag", u) == 0) {
+			t.Fatalf("ERROR: expected 0.01%% to be exactly bucket 0")
+		}
+	}
+}
+
+func TestLayer(t *testing.T) {
+	if _, err := NewLayer("l", Experiment{"a", 60}, Experiment{"b", 50}); err != ErrAllocation {
+		t.Errorf("ERROR: expected ErrAllocation but got %v", err)
+	}
+
+	ui, _ := NewLayer("ui", Experiment{"blue", 10}, Experiment{"green", 10})
+	ranking, _ := NewLayer("ranking", Experiment{"bm25", 50})
+
+	all := users(100000)
+	counts := map[string]int{}
+	for _, u := range all {
+		a, inUI := ui.Assign(u)
+		b, inRanking := ranking.Assign(u)
+		if inUI {
+			counts[a]++
+		}
+		if inUI && inRanking {
+			counts[a+"+"+b]++
+		}
+	}
+
+	for name, expected := range map[string]float64{"blue": 0.1, "green": 0.1, "blue+bm25": 0.05, "green+bm25": 0.05} {
+		if share := float64(counts[name]) / float64(len(all)); math.Abs(share-expected) > 0.005 {
+			t.Errorf("ERROR: expected %v of users in %s but got %v", expected, name, share)
+		}
+	}
+}
+
+func TestCheckDistribution(t *testing.T) {
+	all := users(50000)
+	if d := CheckDistribution("flag", all, 100); !d.Uniform() {
+		t.Errorf("ERROR: expected a uniform distribution but got chi-square %v (z %v)", d.ChiSquare, d.Z)
+	}
+	if d := CheckDistribution("flag", all, 7); !d.Uniform() || len(d.Counts) != 7 {
+		t.Errorf("ERROR: expected a uniform distribution over 7 bins but got chi-square %v (z %v)", d.ChiSquare, d.Z)
+	}
+
+	// Users already in a 50% rollout of the same flag fill half the bins.
+	var half []string
+	for _, u := range all {
+		if InRollout("flag", u, 50) {
+			half = append(half, u)
+		}
+	}
+	if d := CheckDistribution("flag", half, 100); d.Uniform() {
+		t.Errorf("ERROR: expected a skewed distribution but got z %v", d.Z)
+	}
+}
@@ -0,0 +1,63 @@
+package cityhash
+
+import (
+	"encoding/binary"
+	"hash"
+)
+
+type City128 struct {
+	s []byte
+
+	seeded bool
+	seed   Uint128
+}
+
+var _ hash.Hash = (*City128)(nil)
+
+// New128 returns a City128 computing CityHash128. It buffers all input in
+// memory, and Write fails with ErrTooLong past MaxLength bytes; use
+// HashReader128Context to stream longer input.
+func New128() *City128 {
+	return &City128{}
+}
+
+// New128WithSeed returns a City128 computing CityHash128WithSeed, with the
+// same limits as New128.
+func New128WithSeed(seed Uint128) *City128 {
+	return &City128{seeded: true, seed: seed}
+}
+
+// Sum appends Higher64 and then Lower64 of the hash, both big endian, so its
+// hex encoding reads like a 128-bit number.
+func (this *City128) Sum(b []byte) []byte {
+	u := this.Sum128()
+	b2 := make([]byte, 16)
+	binary.BigEndian.PutUint64(b2, u.Higher64())
+	binary.BigEndian.PutUint64(b2[8:], u.Lower64())
+	b = append(b, b2...)
+	return b
+}
+
+func (this *City128) Sum128() Uint128 {
+	if this.seeded {
+		return CityHash128WithSeed(this.s, uint32(len(this.s)), this.seed)
+	}
+	return CityHash128(this.s, uint32(len(this.s)))
+}
+
+func (this *City128) Reset() {
+	this.s = this.s[0:0]
+}
+
+func (this *City128) BlockSize() int {
+	return 1
+}
+
+func (this *City128) Write(s []byte) (n int, err error) {
+	this.s, n, err = bufferInput(this.s, s)
+	return n, err
+}
+
+func (this *City128) Size() int {
+	return 16
+}
@@ -0,0 +1,65 @@
+package cityhash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+)
+
+// MaxLength is the longest input the buffering hashers accept; the CityHash
+// functions take its length as a uint32.
+const MaxLength = math.MaxUint32
+
+// ErrTooLong is returned by the Write methods of the buffering hashers once
+// the input would pass MaxLength bytes.
+var ErrTooLong = fmt.Errorf("cityhash: input longer than %d bytes", uint64(MaxLength))
+
+// bufferInput appends p to the buffered input s, refusing to pass MaxLength.
+func bufferInput(s, p []byte) ([]byte, int, error) {
+	if uint64(len(s))+uint64(len(p)) > MaxLength {
+		return s, 0, ErrTooLong
+	}
+	return append(s, p...), len(p), nil
+}
+
+type City32 struct {
+	s []byte
+}
+
+var _ hash.Hash32 = (*City32)(nil)
+var _ hash.Hash = (*City32)(nil)
+
+// New32 returns a hash.Hash32 computing CityHash32. It buffers all input in
+// memory, and Write fails with ErrTooLong past MaxLength bytes.
+func New32() hash.Hash32 {
+	return &City32{}
+}
+
+func (this *City32) Sum(b []byte) []byte {
+	b2 := make([]byte, 4)
+	binary.BigEndian.PutUint32(b2, this.Sum32())
+	b = append(b, b2...)
+	return b
+}
+
+func (this *City32) Sum32() uint32 {
+	return CityHash32(this.s, uint32(len(this.s)))
+}
+
+func (this *City32) Reset() {
+	this.s = this.s[0:0]
+}
+
+func (this *City32) BlockSize() int {
+	return 1
+}
+
+func (this *City32) Write(s []byte) (n int, err error) {
+	this.s, n, err = bufferInput(this.s, s)
+	return n, err
+}
+
+func (this *City32) Size() int {
+	return 4
+}
@@ -7,6 +7,9 @@ import (
 
 type City64 struct {
 	s []byte
+
+	seeded       bool
+	seed0, seed1 uint64
 }
 
 var _ hash.Hash64 = (*City64)(nil)
@@ -16,6 +19,19 @@ func New64() hash.Hash64 {
 	return &City64{}
 }
 
+// New64WithSeed returns a hash.Hash64 computing CityHash64WithSeed. Like all
+// the hashers it buffers its input, and Write fails with ErrTooLong past
+// MaxLength bytes.
+func New64WithSeed(seed uint64) hash.Hash64 {
+	return New64WithSeeds(k2, seed)
+}
+
+// New64WithSeeds returns a hash.Hash64 computing CityHash64WithSeeds, with
+// the same limits as New64WithSeed.
+func New64WithSeeds(seed0, seed1 uint64) hash.Hash64 {
+	return &City64{seeded: true, seed0: seed0, seed1: seed1}
+}
+
 func (this *City64) Sum(b []byte) []byte {
 	b2 := make([]byte, 8)
 	binary.BigEndian.PutUint64(b2, this.Sum64())
@@ -24,6 +40,9 @@ func (this *City64) Sum(b []byte) []byte {
 }
 
 func (this *City64) Sum64() uint64 {
+	if this.seeded {
+		return CityHash64WithSeeds(this.s, uint32(len(this.s)), this.seed0, this.seed1)
+	}
 	return CityHash64(this.s, uint32(len(this.s)))
 }
 
@@ -36,8 +55,8 @@ func (this *City64) BlockSize() int {
 }
 
 func (this *City64) Write(s []byte) (n int, err error) {
-	this.s = append(this.s, s...)
-	return len(s), nil
+	this.s, n, err = bufferInput(this.s, s)
+	return n, err
 }
 
 func (this *City64) Size() int {
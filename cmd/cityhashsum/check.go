@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type checkOptions struct {
+	quiet         bool // don't print OK for each verified file
+	status        bool // print nothing, only set the exit status
+	ignoreMissing bool // don't fail or report for missing files
+	strict        bool // exit non-zero on improperly formatted lines
+	warn          bool // warn about improperly formatted lines
+}
+
+// parseCheckLine parses a "hash  file" or "ALGORITHM (file) = hash" line.
+// Untagged lines use -a if explicit is set, and otherwise the unseeded
+// algorithm whose digest has the length of hash.
+func (this *command) parseCheckLine(line string, explicit bool) (alg *algorithm, name string, digest []byte, ok bool) {
+	var hexDigest string
+
+	if i := strings.Index(line, " ("); i > 0 {
+		if j := strings.LastIndex(line, ") = "); j > i {
+			if alg = lookupAlgorithm(line[:i]); alg != nil {
+				name, hexDigest = line[i+2:j], line[j+4:]
+			}
+		}
+	}
+
+	if alg == nil {
+		i := strings.Index(line, " ")
+		if i <= 0 || i+1 >= len(line) || (line[i+1] != ' ' && line[i+1] != '*') {
+			return nil, "", nil, false
+		}
+		hexDigest, name = line[:i], line[i+2:]
+
+		if explicit {
+			alg = this.alg
+		} else {
+			for _, n := range []string{"city32", "city64", "city128"} {
+				if a := lookupAlgorithm(n); a.size*2 == len(hexDigest) {
+					alg = a
+				}
+			}
+		}
+	}
+
+	digest, err := hex.DecodeString(hexDigest)
+	if err != nil || alg == nil || len(digest) != alg.size || name == "" {
+		return nil, "", nil, false
+	}
+
+	return alg, name, digest, true
+}
+
+// check verifies the digests listed in each manifest and returns the exit
+// status, following the semantics of sha256sum -c.
+func (this *command) check(manifests []string, explicit bool, opts checkOptions) int {
+	status := 0
+
+	for _, manifest := range manifests {
+		if !this.checkManifest(manifest, explicit, opts) {
+			status = 1
+		}
+	}
+
+	return status
+}
+
+func (this *command) checkManifest(manifest string, explicit bool, opts checkOptions) bool {
+	r := this.stdin
+	if manifest != "-" {
+		f, err := os.Open(manifest)
+		if err != nil {
+			fmt.Fprintf(this.stderr, "cityhashsum: %v\n", err)
+			return false
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var malformed, mismatched, unreadable, verified int
+	var properlyFormatted bool
+
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		alg, name, expected, ok := this.parseCheckLine(line, explicit)
+		if !ok {
+			malformed++
+			if opts.warn {
+				fmt.Fprintf(this.stderr, "cityhashsum: %s: %d: improperly formatted CityHash checksum line\n", manifest, lineno)
+			}
+			continue
+		}
+		properlyFormatted = true
+
+		actual, err := this.digest(alg, name)
+		if err != nil {
+			if opts.ignoreMissing && os.IsNotExist(err) {
+				continue
+			}
+			unreadable++
+			if !opts.status {
+				fmt.Fprintf(this.stderr, "cityhashsum: %v\n", err)
+				fmt.Fprintf(this.stdout, "%s: FAILED open or read\n", name)
+			}
+			continue
+		}
+		verified++
+
+		if !bytes.Equal(actual, expected) {
+			mismatched++
+			if !opts.status {
+				fmt.Fprintf(this.stdout, "%s: FAILED\n", name)
+			}
+		} else if !opts.quiet && !opts.status {
+			fmt.Fprintf(this.stdout, "%s: OK\n", name)
+		}
+	}
+
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		fmt.Fprintf(this.stderr, "cityhashsum: %s: %v\n", manifest, err)
+		return false
+	}
+
+	if !properlyFormatted {
+		if !opts.status {
+			fmt.Fprintf(this.stderr, "cityhashsum: %s: no properly formatted CityHash checksum lines found\n", manifest)
+		}
+		return false
+	}
+
+	if !opts.status {
+		if malformed > 0 {
+			fmt.Fprintf(this.stderr, "cityhashsum: WARNING: %d %s improperly formatted\n", malformed, plural(malformed, "line is", "lines are"))
+		}
+		if unreadable > 0 {
+			fmt.Fprintf(this.stderr, "cityhashsum: WARNING: %d listed %s could not be read\n", unreadable, plural(unreadable, "file", "files"))
+		}
+		if mismatched > 0 {
+			fmt.Fprintf(this.stderr, "cityhashsum: WARNING: %d computed %s did NOT match\n", mismatched, plural(mismatched, "checksum", "checksums"))
+		}
+		if opts.ignoreMissing && verified == 0 {
+			fmt.Fprintf(this.stderr, "cityhashsum: %s: no file was verified\n", manifest)
+		}
+	}
+
+	return mismatched == 0 && unreadable == 0 &&
+		!(opts.strict && malformed > 0) &&
+		!(opts.ignoreMissing && verified == 0)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zentures/cityhash"
+	"github.com/zentures/cityhash/dirhash"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestSum(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt")
+	content := []byte("hello, cityhash")
+	if err := os.WriteFile(name, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := uint32(len(content))
+	u := cityhash.CityHash128(content, l)
+	v := cityhash.CityHash128WithSeed(content, l, cityhash.Uint128{1, 2})
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{name}, fmt.Sprintf("%016x  %s\n", cityhash.CityHash64(content, l), name)},
+		{[]string{"-a", "city32", name}, fmt.Sprintf("%08x  %s\n", cityhash.CityHash32(content, l), name)},
+		{[]string{"-a", "city64seed", "-seed", "7", name}, fmt.Sprintf("%016x  %s\n", cityhash.CityHash64WithSeed(content, l, 7), name)},
+		{[]string{"-a", "city64seeds", "-seed", "7", "-seed1", "8", name}, fmt.Sprintf("%016x  %s\n", cityhash.CityHash64WithSeeds(content, l, 7, 8), name)},
+		{[]string{"-a", "city128", name}, fmt.Sprintf("%016x%016x  %s\n", u.Higher64(), u.Lower64(), name)},
+		{[]string{"-a", "city128seed", "-seed", "1", "-seed1", "2", name}, fmt.Sprintf("%016x%016x  %s\n", v.Higher64(), v.Lower64(), name)},
+		{[]string{"--tag", name}, fmt.Sprintf("CITY64 (%s) = %016x\n", name, cityhash.CityHash64(content, l))},
+	}
+
+	for _, tt := range tests {
+		status, stdout, stderr := runCommand(t, "", tt.args...)
+		if status != 0 || stdout != tt.expected {
+			t.Errorf("ERROR: %v: expected %q but got %q (status %d, %s)", tt.args, tt.expected, stdout, status, stderr)
+		}
+	}
+
+	status, stdout, _ := runCommand(t, string(content))
+	if expected := fmt.Sprintf("%016x  -\n", cityhash.CityHash64(content, l)); status != 0 || stdout != expected {
+		t.Errorf("ERROR: stdin: expected %q but got %q (status %d)", expected, stdout, status)
+	}
+
+	if status, _, _ = runCommand(t, "", filepath.Join(dir, "missing")); status != 1 {
+		t.Errorf("ERROR: expected status 1 for a missing file but got %d", status)
+	}
+	// Input CityHash64 cannot take fails instead of hashing a wrapped length.
+	huge := filepath.Join(dir, "huge")
+	if f, err := os.Create(huge); err == nil {
+		err = f.Truncate(cityhash.MaxLength + 1)
+		f.Close()
+		if err == nil {
+			if status, stdout, stderr := runCommand(t, "", huge); status != 1 || stdout != "" || !strings.Contains(stderr, "longer than") {
+				t.Errorf("ERROR: expected status 1 for a 4 GiB file but got %d, %q, %q", status, stdout, stderr)
+			}
+		}
+	}
+
+	if status, _, _ = runCommand(t, "", "-a", "md5"); status != 2 {
+		t.Errorf("ERROR: expected status 2 for an unknown algorithm but got %d", status)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	os.WriteFile(a, []byte("alpha"), 0644)
+	os.WriteFile(b, []byte("beta"), 0644)
+
+	_, sums, _ := runCommand(t, "", "-a", "city128", a, b)
+	_, tagged, _ := runCommand(t, "", "-a", "city32", "--tag", a)
+
+	manifest := filepath.Join(dir, "SUMS")
+	write := func(content string) {
+		if err := os.WriteFile(manifest, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(sums + tagged)
+	status, stdout, _ := runCommand(t, "", "-c", manifest)
+	if expected := a + ": OK\n" + b + ": OK\n" + a + ": OK\n"; status != 0 || stdout != expected {
+		t.Errorf("ERROR: expected %q but got %q (status %d)", expected, stdout, status)
+	}
+
+	// A changed file fails, and --quiet still reports it.
+	os.WriteFile(b, []byte("gamma"), 0644)
+	status, stdout, stderr := runCommand(t, "", "-c", "--quiet", manifest)
+	if expected := b + ": FAILED\n"; status != 1 || stdout != expected || !strings.Contains(stderr, "1 computed checksum did NOT match") {
+		t.Errorf("ERROR: expected %q but got %q (status %d, %s)", expected, stdout, status, stderr)
+	}
+
+	status, stdout, stderr = runCommand(t, "", "-c", "--status", manifest)
+	if status != 1 || stdout != "" || stderr != "" {
+		t.Errorf("ERROR: --status: expected no output and status 1 but got %q, %q (status %d)", stdout, stderr, status)
+	}
+
+	// Missing files fail unless --ignore-missing is given.
+	os.Remove(b)
+	if status, _, _ = runCommand(t, "", "-c", manifest); status != 1 {
+		t.Errorf("ERROR: expected status 1 for a missing file but got %d", status)
+	}
+	if status, stdout, _ = runCommand(t, "", "-c", "--ignore-missing", manifest); status != 0 || strings.Contains(stdout, b) {
+		t.Errorf("ERROR: --ignore-missing: got %q (status %d)", stdout, status)
+	}
+
+	// Malformed lines only fail with --strict.
+	write(tagged + "not a checksum line\n")
+	if status, _, stderr = runCommand(t, "", "-c", manifest); status != 0 || !strings.Contains(stderr, "1 line is improperly formatted") {
+		t.Errorf("ERROR: expected status 0 and a warning but got status %d, %q", status, stderr)
+	}
+	if status, _, _ = runCommand(t, "", "-c", "--strict", manifest); status != 1 {
+		t.Errorf("ERROR: --strict: expected status 1 but got %d", status)
+	}
+
+	write("garbage\n")
+	if status, _, stderr = runCommand(t, "", "-c", manifest); status != 1 || !strings.Contains(stderr, "no properly formatted") {
+		t.Errorf("ERROR: expected status 1 for a manifest without checksums but got %d, %q", status, stderr)
+	}
+}
+
+func TestTree(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a"), []byte("alpha"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.tmp"), []byte("beta"), 0644)
+
+	h, entries, err := dirhash.Hash(dir, &dirhash.Options{Exclude: []string{"*.tmp"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, stdout, _ := runCommand(t, "", "--tree", "--exclude", "*.tmp", dir)
+	if expected := fmt.Sprintf("%016x%016x  %s\n", h.Higher64(), h.Lower64(), dir); status != 0 || stdout != expected {
+		t.Errorf("ERROR: expected %q but got %q (status %d)", expected, stdout, status)
+	}
+
+	status, stdout, _ = runCommand(t, "", "--tree", "--manifest", "--exclude", "*.tmp", dir)
+	if expected := entries[0].String() + "\n" + entries[1].String() + "\n"; status != 0 || stdout != expected {
+		t.Errorf("ERROR: expected %q but got %q (status %d)", expected, stdout, status)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zentures/cityhash/dirhash"
+)
+
+type treeOptions struct {
+	exclude  stringList
+	follow   bool
+	manifest bool
+}
+
+// stringList collects the values of a repeated flag.
+type stringList []string
+
+func (this *stringList) String() string {
+	return strings.Join(*this, ",")
+}
+
+func (this *stringList) Set(s string) error {
+	*this = append(*this, s)
+	return nil
+}
+
+// tree prints the dirhash fingerprint of each directory, or with --manifest
+// one line per entry below it.
+func (this *command) tree(dirs []string, opts treeOptions) int {
+	status := 0
+
+	for _, dir := range dirs {
+		h, entries, err := dirhash.Hash(dir, &dirhash.Options{
+			Exclude:        opts.exclude,
+			FollowSymlinks: opts.follow,
+		})
+		if err != nil {
+			fmt.Fprintf(this.stderr, "cityhashsum: %v\n", err)
+			status = 1
+			continue
+		}
+
+		if opts.manifest {
+			dirhash.WriteManifest(this.stdout, entries)
+		} else if this.tag {
+			fmt.Fprintf(this.stdout, "CITYTREE (%s) = %016x%016x\n", dir, h.Higher64(), h.Lower64())
+		} else {
+			fmt.Fprintf(this.stdout, "%016x%016x  %s\n", h.Higher64(), h.Lower64(), dir)
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,129 @@
+// Command citysample copies the lines of standard input whose key is kept by
+// a sample.Threshold or sample.Seeded sampler, so that every service sampling
+// the same keys at the same rate keeps the same lines.
+//
+// Usage:
+//
+//	citysample [-rate r] [-seed n] [-k field] [-d delimiter] [file ...]
+//
+// The key is field -k of the line, counted from 1, with fields separated by
+// -d or, by default, by runs of white space. With -k 0 the whole line is the
+// key. Lines with fewer fields are dropped. With -seed the sample is chosen
+// by CityHash64WithSeed instead of CityHash64.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zentures/cityhash/sample"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("citysample", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	rate := fs.Float64("rate", 0.01, "fraction of keys to keep")
+	seed := fs.Uint64("seed", 0, "sample with CityHash64WithSeed and this seed")
+	field := fs.Int("k", 0, "key field, counted from 1; 0 for the whole line")
+	delim := fs.String("d", "", "field delimiter; white space if empty")
+
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: citysample [flags] [file ...]\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *rate < 0 || *rate > 1 || *field < 0 {
+		fmt.Fprintf(stderr, "citysample: -rate must be in [0, 1] and -k non-negative\n")
+		return 2
+	}
+
+	var s sample.Sampler = sample.NewThreshold(*rate)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			s = sample.NewSeeded(*rate, *seed)
+		}
+	})
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	status := 0
+	for _, name := range files {
+		if err := filterFile(name, stdin, w, s, *field, *delim); err != nil {
+			fmt.Fprintf(stderr, "citysample: %v\n", err)
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// filterFile filters the named file, or standard input for "-".
+func filterFile(name string, stdin io.Reader, w io.Writer, s sample.Sampler, field int, delim string) error {
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if err := filter(r, w, s, field, delim); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// filter copies the lines of r whose key s keeps to w.
+func filter(r io.Reader, w io.Writer, s sample.Sampler, field int, delim string) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		key, ok := line, true
+		if field > 0 {
+			key, ok = column(line, field, delim)
+		}
+		if ok && s.Sample([]byte(key)) {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func column(line string, field int, delim string) (string, bool) {
+	var fields []string
+	if delim == "" {
+		fields = strings.Fields(line)
+	} else {
+		fields = strings.Split(line, delim)
+	}
+
+	if field > len(fields) {
+		return "", false
+	}
+	return fields[field-1], true
+}
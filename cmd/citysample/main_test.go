@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/zentures/cityhash/sample"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestSample(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&input, "%d,trace-%d,GET /\n", i, i%500)
+	}
+
+	threshold, seeded := sample.NewThreshold(0.2), sample.NewSeeded(0.2, 9)
+	tests := []struct {
+		args []string
+		keep func(i int) bool
+	}{
+		{[]string{"-rate", "0.2", "-k", "2", "-d", ","}, func(i int) bool {
+			return threshold.Sample([]byte(fmt.Sprintf("trace-%d", i%500)))
+		}},
+		{[]string{"-rate", "0.2", "-seed", "9", "-k", "2", "-d", ","}, func(i int) bool {
+			return seeded.Sample([]byte(fmt.Sprintf("trace-%d", i%500)))
+		}},
+		{[]string{"-rate", "0.2"}, func(i int) bool {
+			return threshold.Sample([]byte(fmt.Sprintf("%d,trace-%d,GET /", i, i%500)))
+		}},
+		{[]string{"-rate", "0.2", "-k", "2"}, func(i int) bool {
+			return threshold.Sample([]byte("/"))
+		}},
+		{[]string{"-k", "5", "-d", ","}, func(i int) bool { return false }},
+	}
+
+	for _, tt := range tests {
+		var expected strings.Builder
+		for i := 0; i < 2000; i++ {
+			if tt.keep(i) {
+				fmt.Fprintf(&expected, "%d,trace-%d,GET /\n", i, i%500)
+			}
+		}
+
+		status, stdout, stderr := runCommand(t, input.String(), tt.args...)
+		if status != 0 || stdout != expected.String() {
+			t.Errorf("ERROR: %v: expected %d bytes but got %d (status %d, %s)", tt.args, expected.Len(), len(stdout), status, stderr)
+		}
+	}
+
+	if status, _, _ := runCommand(t, "", "-rate", "2"); status != 2 {
+		t.Errorf("ERROR: expected status 2 for a bad rate but got %d", status)
+	}
+}
@@ -0,0 +1,180 @@
+// Package countmin implements a count-min sketch (Cormode and Muthukrishnan)
+// for frequency estimation in bounded memory.
+//
+// The d row indexes of a key come from a single CityHash128WithSeed call:
+// with h1 and h2 its two 64-bit halves, row i uses column h1 + i*h2 (mod w).
+// All methods are safe for concurrent use. Counters are updated atomically,
+// and conservative updates exclude all other updates while they run, so no
+// increment is ever lost.
+package countmin
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zentures/cityhash"
+)
+
+// DefaultSeed is the seed used by New and NewWithEstimates.
+var DefaultSeed = cityhash.Uint128{0xc3a5c85c97cb3127, 0xb492b66fbe98f273}
+
+var (
+	ErrIncompatible = errors.New("countmin: incompatible sketches")
+	ErrEstimates    = errors.New("countmin: epsilon must be positive and delta in (0, 1)")
+	ErrTooLarge     = errors.New("countmin: sketch too large")
+)
+
+// maxCounters is the most counters a sketch can have: the largest slice of
+// uint64 that can be allocated.
+const maxCounters = uint64(^uint(0)>>1) / 8
+
+// Sketch is a count-min sketch of depth rows of width counters.
+type Sketch struct {
+	width    uint64
+	depth    uint64
+	seed     cityhash.Uint128
+	total    uint64
+	counters []uint64 // row i is counters[i*width : (i+1)*width]
+
+	// mu is held shared by Add and Merge, whose atomic increments commute,
+	// and exclusively by AddConservative, which must see a stable minimum.
+	mu sync.RWMutex
+}
+
+// New returns a sketch of the given width and depth.
+func New(width, depth uint64) *Sketch {
+	return NewWithSeed(width, depth, DefaultSeed)
+}
+
+// NewWithSeed is like New but hashes keys with the given seed. Only sketches
+// with equal seeds and dimensions can be merged. A width or depth of 0 is
+// taken as 1, and dimensions whose product would not fit in memory are cut
+// down, depth first, until it does.
+func NewWithSeed(width, depth uint64, seed cityhash.Uint128) *Sketch {
+	if width == 0 {
+		width = 1
+	} else if width > maxCounters {
+		width = maxCounters
+	}
+	if depth == 0 {
+		depth = 1
+	} else if depth > maxCounters/width {
+		depth = maxCounters / width
+	}
+
+	return &Sketch{
+		width:    width,
+		depth:    depth,
+		seed:     seed,
+		counters: make([]uint64, width*depth),
+	}
+}
+
+// NewWithEstimates returns a sketch whose estimates exceed the true count by
+// at most epsilon times the total count, with probability 1-delta. It fails
+// with ErrEstimates unless epsilon > 0 and 0 < delta < 1, and with ErrTooLarge
+// if the sketch would not fit in memory.
+func NewWithEstimates(epsilon, delta float64) (*Sketch, error) {
+	if !(epsilon > 0) || !(delta > 0 && delta < 1) {
+		return nil, ErrEstimates
+	}
+
+	width := math.Ceil(math.E / epsilon)
+	depth := math.Ceil(math.Log(1 / delta))
+	if width*depth > float64(maxCounters) {
+		return nil, ErrTooLarge
+	}
+	return New(uint64(width), uint64(depth)), nil
+}
+
+func (this *Sketch) Width() uint64 {
+	return this.width
+}
+
+func (this *Sketch) Depth() uint64 {
+	return this.depth
+}
+
+// Total returns the sum of all counts added.
+func (this *Sketch) Total() uint64 {
+	return atomic.LoadUint64(&this.total)
+}
+
+// cells returns the double hashing pair for key.
+func (this *Sketch) cells(key []byte) (uint64, uint64) {
+	h := cityhash.CityHash128WithSeed(key, uint32(len(key)), this.seed)
+	return h.Lower64(), h.Higher64()
+}
+
+func (this *Sketch) cell(h1, h2, row uint64) *uint64 {
+	return &this.counters[row*this.width+(h1+row*h2)%this.width]
+}
+
+// Add adds count to every row's counter of key.
+func (this *Sketch) Add(key []byte, count uint64) {
+	h1, h2 := this.cells(key)
+
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	for i := uint64(0); i < this.depth; i++ {
+		atomic.AddUint64(this.cell(h1, h2, i), count)
+	}
+	atomic.AddUint64(&this.total, count)
+}
+
+// AddConservative adds count with the conservative update rule: counters are
+// only raised as far as the new estimate of key, which keeps estimates of
+// other keys lower than Add does. Conservative updates run one at a time and
+// exclude Add and Merge: reading the minimum and raising the counters must
+// not interleave with another update, or increments would be lost.
+func (this *Sketch) AddConservative(key []byte, count uint64) {
+	h1, h2 := this.cells(key)
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	target := this.estimate(h1, h2) + count
+	for i := uint64(0); i < this.depth; i++ {
+		if c := this.cell(h1, h2, i); atomic.LoadUint64(c) < target {
+			atomic.StoreUint64(c, target)
+		}
+	}
+	atomic.AddUint64(&this.total, count)
+}
+
+// Estimate returns an estimate of the count of key that is never below the
+// true count.
+func (this *Sketch) Estimate(key []byte) uint64 {
+	h1, h2 := this.cells(key)
+	return this.estimate(h1, h2)
+}
+
+func (this *Sketch) estimate(h1, h2 uint64) uint64 {
+	var min uint64 = math.MaxUint64
+	for i := uint64(0); i < this.depth; i++ {
+		if c := atomic.LoadUint64(this.cell(h1, h2, i)); c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// Merge adds the counts of other, which must have the same dimensions and
+// seed.
+func (this *Sketch) Merge(other *Sketch) error {
+	if this.width != other.width || this.depth != other.depth || this.seed != other.seed {
+		return ErrIncompatible
+	}
+
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	for i := range other.counters {
+		atomic.AddUint64(&this.counters[i], atomic.LoadUint64(&other.counters[i]))
+	}
+	atomic.AddUint64(&this.total, other.Total())
+	return nil
+}
@@ -0,0 +1,142 @@
+package countmin
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("/path/%d", i))
+}
+
+// zipf-ish stream: key i appears 1000/(i+1) times.
+func feed(add func([]byte, uint64)) map[int]uint64 {
+	counts := make(map[int]uint64)
+	for i := 0; i < 2000; i++ {
+		n := uint64(1000 / (i + 1))
+		if n == 0 {
+			n = 1
+		}
+		add(key(i), n)
+		counts[i] = n
+	}
+	return counts
+}
+
+func TestSketch(t *testing.T) {
+	const epsilon = 0.001
+
+	plain, err := NewWithEstimates(epsilon, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conservative, _ := NewWithEstimates(epsilon, 0.01)
+	counts := feed(plain.Add)
+	feed(conservative.AddConservative)
+
+	if plain.Total() != conservative.Total() {
+		t.Errorf("ERROR: expected equal totals but got %d and %d", plain.Total(), conservative.Total())
+	}
+
+	bound := uint64(epsilon * float64(plain.Total()))
+	over := 0
+	for i, n := range counts {
+		p, c := plain.Estimate(key(i)), conservative.Estimate(key(i))
+		if p < n || c < n {
+			t.Fatalf("ERROR: %s: estimates %d and %d are below the true count %d", key(i), p, c, n)
+		}
+		if c > p {
+			t.Errorf("ERROR: %s: conservative estimate %d exceeds plain estimate %d", key(i), c, p)
+		}
+		if p-n > bound {
+			over++
+		}
+	}
+	if over > len(counts)/100 {
+		t.Errorf("ERROR: %d of %d estimates are off by more than %d", over, len(counts), bound)
+	}
+}
+
+func TestSketchMerge(t *testing.T) {
+	a, b, all := New(1000, 4), New(1000, 4), New(1000, 4)
+	for i := 0; i < 500; i++ {
+		a.Add(key(i), 2)
+		b.Add(key(i+250), 3)
+		all.Add(key(i), 2)
+		all.Add(key(i+250), 3)
+	}
+
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 750; i++ {
+		if a.Estimate(key(i)) != all.Estimate(key(i)) {
+			t.Fatalf("ERROR: %s: expected %d but got %d", key(i), all.Estimate(key(i)), a.Estimate(key(i)))
+		}
+	}
+
+	if err := a.Merge(New(1000, 5)); err != ErrIncompatible {
+		t.Errorf("ERROR: expected ErrIncompatible but got %v", err)
+	}
+}
+
+func TestNewWithEstimates(t *testing.T) {
+	for _, c := range []struct {
+		epsilon, delta float64
+		err            error
+	}{
+		{0, 0.01, ErrEstimates},
+		{-0.1, 0.01, ErrEstimates},
+		{math.NaN(), 0.01, ErrEstimates},
+		{0.01, 0, ErrEstimates},
+		{0.01, 1, ErrEstimates},
+		{0.01, math.NaN(), ErrEstimates},
+		{1e-300, 0.01, ErrTooLarge},
+	} {
+		if _, err := NewWithEstimates(c.epsilon, c.delta); err != c.err {
+			t.Errorf("ERROR: %v, %v: expected %v but got %v", c.epsilon, c.delta, c.err, err)
+		}
+	}
+
+	s, err := NewWithEstimates(0.01, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Width() != 272 || s.Depth() != 5 {
+		t.Errorf("ERROR: expected 272x5 but got %dx%d", s.Width(), s.Depth())
+	}
+}
+
+func TestSketchConcurrent(t *testing.T) {
+	s := New(2000, 5)
+
+	const workers, n = 8, 20000
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				s.AddConservative([]byte("hot"), 1)
+				s.Add(key(i%10), 1)
+				s.AddConservative(key(10+i%10), 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Estimates are never below the true counts, however updates interleave.
+	if e := s.Estimate([]byte("hot")); e < workers*n {
+		t.Errorf("ERROR: hot: expected at least %d but got %d", workers*n, e)
+	}
+	for i := 0; i < 20; i++ {
+		if e := s.Estimate(key(i)); e < workers*n/10 {
+			t.Errorf("ERROR: %s: expected at least %d but got %d", key(i), workers*n/10, e)
+		}
+	}
+	if s.Total() != 3*workers*n {
+		t.Errorf("ERROR: expected total %d but got %d", 3*workers*n, s.Total())
+	}
+}
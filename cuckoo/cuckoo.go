@@ -0,0 +1,286 @@
+// Package cuckoo implements a cuckoo filter keyed by CityHash64, after Fan et
+// al., "Cuckoo Filter: Practically Better Than Bloom".
+//
+// A key's 64-bit hash h gives its fingerprint, the high bits of h truncated
+// to the fingerprint size (0 is replaced by 1), and its first bucket, the low
+// bits of h. Its alternate bucket is the first one xor CityHash64 of the
+// fingerprint as 4 little endian bytes, so either bucket leads to the other.
+package cuckoo
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/zentures/cityhash"
+)
+
+const (
+	DefaultFingerprintBits = 16
+	DefaultBucketSize      = 4
+	DefaultMaxKicks        = 500
+)
+
+var (
+	ErrFull    = errors.New("cuckoo: filter full")
+	ErrInvalid = errors.New("cuckoo: invalid encoding")
+)
+
+// Filter is a cuckoo filter. It is not safe for concurrent use.
+type Filter struct {
+	fpBits     uint   // bits per fingerprint, 2 to 32
+	bucketSize uint   // fingerprints per bucket
+	buckets    uint64 // a power of two
+	count      uint64
+	table      []uint64 // fingerprints packed back to back
+	rand       uint64   // xorshift state for choosing victims
+
+	MaxKicks int // relocations Insert tries before it gives up
+}
+
+// New returns a filter for capacity keys with 16-bit fingerprints and four
+// fingerprints per bucket.
+func New(capacity uint64) *Filter {
+	return NewWithSize(capacity, DefaultFingerprintBits, DefaultBucketSize)
+}
+
+// NewWithSize returns a filter for capacity keys with fingerprints of fpBits
+// (2 to 32) bits and bucketSize (1 to 255, the most the encoding can hold)
+// fingerprints per bucket. Values outside those ranges are clamped. The
+// false positive rate is about 2*bucketSize/2^fpBits.
+func NewWithSize(capacity uint64, fpBits, bucketSize uint) *Filter {
+	if fpBits < 2 {
+		fpBits = 2
+	} else if fpBits > 32 {
+		fpBits = 32
+	}
+	if bucketSize == 0 {
+		bucketSize = 1
+	} else if bucketSize > 255 {
+		bucketSize = 255
+	}
+
+	// The occupancy a table reaches before inserts start to fail, from the
+	// paper's measurements.
+	load := 0.98
+	switch {
+	case bucketSize == 1:
+		load = 0.5
+	case bucketSize < 4:
+		load = 0.84
+	case bucketSize < 8:
+		load = 0.95
+	}
+
+	buckets := uint64(1)
+	for float64(buckets*uint64(bucketSize))*load < float64(capacity) {
+		buckets <<= 1
+	}
+
+	return newFilter(fpBits, bucketSize, buckets)
+}
+
+func newFilter(fpBits, bucketSize uint, buckets uint64) *Filter {
+	return &Filter{
+		fpBits:     fpBits,
+		bucketSize: bucketSize,
+		buckets:    buckets,
+		table:      make([]uint64, (buckets*uint64(bucketSize)*uint64(fpBits)+63)/64),
+		rand:       0x9e3779b97f4a7c15,
+		MaxKicks:   DefaultMaxKicks,
+	}
+}
+
+// Count returns the number of fingerprints stored.
+func (this *Filter) Count() uint64 {
+	return this.count
+}
+
+// Cap returns the number of fingerprint slots.
+func (this *Filter) Cap() uint64 {
+	return this.buckets * uint64(this.bucketSize)
+}
+
+func (this *Filter) get(slot uint64) uint32 {
+	bit := slot * uint64(this.fpBits)
+	w, off := bit>>6, bit&63
+
+	v := this.table[w] >> off
+	if off+uint64(this.fpBits) > 64 {
+		v |= this.table[w+1] << (64 - off)
+	}
+	return uint32(v & (1<<this.fpBits - 1))
+}
+
+func (this *Filter) set(slot uint64, fp uint32) {
+	bit := slot * uint64(this.fpBits)
+	w, off := bit>>6, bit&63
+	mask := uint64(1)<<this.fpBits - 1
+
+	this.table[w] = this.table[w]&^(mask<<off) | uint64(fp)<<off
+	if off+uint64(this.fpBits) > 64 {
+		this.table[w+1] = this.table[w+1]&^(mask>>(64-off)) | uint64(fp)>>(64-off)
+	}
+}
+
+// locate returns the fingerprint and first bucket of key.
+func (this *Filter) locate(key []byte) (uint32, uint64) {
+	h := cityhash.CityHash64(key, uint32(len(key)))
+
+	fp := uint32(h>>32) >> (32 - this.fpBits)
+	if fp == 0 {
+		fp = 1
+	}
+	return fp, h & (this.buckets - 1)
+}
+
+func (this *Filter) alt(i uint64, fp uint32) uint64 {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], fp)
+	return (i ^ cityhash.CityHash64(b[:], 4)) & (this.buckets - 1)
+}
+
+// find returns the slot in bucket i holding fp, or -1.
+func (this *Filter) find(i uint64, fp uint32) int64 {
+	for j := uint64(0); j < uint64(this.bucketSize); j++ {
+		if slot := i*uint64(this.bucketSize) + j; this.get(slot) == fp {
+			return int64(slot)
+		}
+	}
+	return -1
+}
+
+// Insert adds key. If no room can be made within MaxKicks relocations it
+// returns ErrFull and leaves the filter as it was.
+func (this *Filter) Insert(key []byte) error {
+	fp, i1 := this.locate(key)
+	i2 := this.alt(i1, fp)
+
+	for _, i := range []uint64{i1, i2} {
+		if slot := this.find(i, 0); slot >= 0 {
+			this.set(uint64(slot), fp)
+			this.count++
+			return nil
+		}
+	}
+
+	type kick struct {
+		slot uint64
+		fp   uint32
+	}
+	var path []kick
+
+	i := i1
+	if this.next()&1 == 1 {
+		i = i2
+	}
+	for n := 0; n < this.MaxKicks; n++ {
+		slot := i*uint64(this.bucketSize) + this.next()%uint64(this.bucketSize)
+		victim := this.get(slot)
+		this.set(slot, fp)
+		path = append(path, kick{slot, victim})
+
+		fp, i = victim, this.alt(i, victim)
+		if slot := this.find(i, 0); slot >= 0 {
+			this.set(uint64(slot), fp)
+			this.count++
+			return nil
+		}
+	}
+
+	// Put every fingerprint back where it was.
+	for n := len(path) - 1; n >= 0; n-- {
+		this.set(path[n].slot, path[n].fp)
+	}
+	return ErrFull
+}
+
+// next steps the xorshift64 generator used to pick victims.
+func (this *Filter) next() uint64 {
+	x := this.rand
+	x ^= x << 13
+	x ^= x >> 7
+	x ^= x << 17
+	this.rand = x
+	return x
+}
+
+// Lookup reports whether key may have been inserted. False means it
+// definitely has not.
+func (this *Filter) Lookup(key []byte) bool {
+	fp, i1 := this.locate(key)
+	return this.find(i1, fp) >= 0 || this.find(this.alt(i1, fp), fp) >= 0
+}
+
+// Delete removes one copy of key and reports whether one was found. Deleting
+// a key that was never inserted may remove another key with the same
+// fingerprint.
+func (this *Filter) Delete(key []byte) bool {
+	fp, i1 := this.locate(key)
+
+	slot := this.find(i1, fp)
+	if slot < 0 {
+		slot = this.find(this.alt(i1, fp), fp)
+	}
+	if slot < 0 {
+		return false
+	}
+
+	this.set(uint64(slot), 0)
+	this.count--
+	return true
+}
+
+// The binary encoding is, little endian throughout:
+//
+//	magic       [4]byte "CHCF"
+//	version     uint8   1
+//	fpBits      uint8
+//	bucketSize  uint8
+//	            uint8   reserved, zero
+//	buckets     uint64
+//	count       uint64
+//	table       ceil(buckets*bucketSize*fpBits/64) uint64 words
+const headerSize = 24
+
+var magic = [4]byte{'C', 'H', 'C', 'F'}
+
+func (this *Filter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, headerSize+8*len(this.table))
+	b = append(b, magic[:]...)
+	b = append(b, 1, uint8(this.fpBits), uint8(this.bucketSize), 0)
+	b = binary.LittleEndian.AppendUint64(b, this.buckets)
+	b = binary.LittleEndian.AppendUint64(b, this.count)
+	for _, w := range this.table {
+		b = binary.LittleEndian.AppendUint64(b, w)
+	}
+	return b, nil
+}
+
+func (this *Filter) UnmarshalBinary(b []byte) error {
+	if len(b) < headerSize || [4]byte(b[:4]) != magic || b[4] != 1 {
+		return ErrInvalid
+	}
+
+	fpBits, bucketSize := uint(b[5]), uint(b[6])
+	buckets := binary.LittleEndian.Uint64(b[8:])
+	if fpBits < 2 || fpBits > 32 || bucketSize == 0 || buckets == 0 || buckets&(buckets-1) != 0 {
+		return ErrInvalid
+	}
+	if bits := uint64(len(b)-headerSize) * 8; bits%64 != 0 || buckets > bits/uint64(bucketSize*fpBits) ||
+		bits/64 != (buckets*uint64(bucketSize*fpBits)+63)/64 {
+		return ErrInvalid
+	}
+
+	f := newFilter(fpBits, bucketSize, buckets)
+	f.count = binary.LittleEndian.Uint64(b[16:])
+	for i := range f.table {
+		f.table[i] = binary.LittleEndian.Uint64(b[headerSize+8*i:])
+	}
+
+	f.MaxKicks = this.MaxKicks
+	if f.MaxKicks == 0 {
+		f.MaxKicks = DefaultMaxKicks
+	}
+	*this = *f
+	return nil
+}
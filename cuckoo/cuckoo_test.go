@@ -0,0 +1,108 @@
+package cuckoo
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("key-%d", i))
+}
+
+func TestFilter(t *testing.T) {
+	for _, size := range []struct{ fpBits, bucketSize uint }{{16, 4}, {12, 4}, {8, 2}, {13, 8}, {32, 1}} {
+		f := NewWithSize(10000, size.fpBits, size.bucketSize)
+
+		n := 0
+		for ; n < 20000; n++ {
+			if err := f.Insert(key(n)); err == ErrFull {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n < 9000 {
+			t.Errorf("ERROR: %v: expected room for 10000 keys but got full after %d", size, n)
+		}
+		if f.Count() != uint64(n) {
+			t.Errorf("ERROR: %v: expected count %d but got %d", size, n, f.Count())
+		}
+
+		// A failed insert must not lose anything.
+		for i := 0; i < n; i++ {
+			if !f.Lookup(key(i)) {
+				t.Fatalf("ERROR: %v: false negative for %s", size, key(i))
+			}
+		}
+
+		fp := 0
+		for i := 100000; i < 200000; i++ {
+			if f.Lookup(key(i)) {
+				fp++
+			}
+		}
+		if rate, bound := float64(fp)/100000, 2*float64(size.bucketSize)/float64(uint64(1)<<size.fpBits); rate > 1.5*bound {
+			t.Errorf("ERROR: %v: expected a false positive rate below %v but got %v", size, bound, rate)
+		}
+
+		for i := 0; i < n; i += 2 {
+			if !f.Delete(key(i)) {
+				t.Fatalf("ERROR: %v: expected to delete %s", size, key(i))
+			}
+		}
+		for i := 1; i < n; i += 2 {
+			if !f.Lookup(key(i)) {
+				t.Fatalf("ERROR: %v: false negative for %s after deletes", size, key(i))
+			}
+		}
+	}
+}
+
+func TestFilterEncoding(t *testing.T) {
+	f := NewWithSize(1000, 12, 4)
+	for i := 0; i < 900; i++ {
+		f.Insert(key(i))
+	}
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var g Filter
+	if err = g.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if g.Count() != f.Count() {
+		t.Errorf("ERROR: expected count %d but got %d", f.Count(), g.Count())
+	}
+	for i := 0; i < 2000; i++ {
+		if f.Lookup(key(i)) != g.Lookup(key(i)) {
+			t.Fatalf("ERROR: decoded filter disagrees on %s", key(i))
+		}
+	}
+
+	c, _ := g.MarshalBinary()
+	if !bytes.Equal(b, c) {
+		t.Errorf("ERROR: expected re-encoding to give the same bytes")
+	}
+
+	if err = g.UnmarshalBinary(b[:len(b)-8]); err != ErrInvalid {
+		t.Errorf("ERROR: expected ErrInvalid for a truncated filter but got %v", err)
+	}
+
+	// Bucket sizes beyond what the encoding holds are clamped, so the
+	// filter still round-trips.
+	big := NewWithSize(1000, 16, 300)
+	if big.bucketSize != 255 {
+		t.Errorf("ERROR: expected bucket size 255 but got %d", big.bucketSize)
+	}
+	big.Insert(key(1))
+	if b, err = big.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	if err = g.UnmarshalBinary(b); err != nil || !g.Lookup(key(1)) {
+		t.Errorf("ERROR: expected a filter with 255-slot buckets to round-trip but got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Package dirhash computes a deterministic CityHash128 fingerprint of a
+// directory tree.
+//
+// A regular file hashes to CityHash128 of its contents and a symbolic link
+// that is not followed hashes to CityHash128 of its target. Other special
+// files hash to CityHash128 of no bytes. A directory hashes to CityHash128 of
+// one record per entry, in byte order of the entry names, where a record is
+//
+//	name, 0x00, mode (uint32, little endian), hash (Uint128.Bytes)
+//
+// and mode keeps only the type and permission bits of Go's fs.FileMode. The
+// fingerprint of a tree is the hash of its root.
+package dirhash
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/zentures/cityhash"
+)
+
+// Options configures Hash.
+type Options struct {
+	// Exclude lists path.Match patterns. An entry is skipped if a pattern
+	// matches its slash-separated path relative to the root or its name.
+	Exclude []string
+
+	// FollowSymlinks hashes what symbolic links point to instead of the
+	// links themselves.
+	FollowSymlinks bool
+}
+
+// Entry is one file or directory visited while hashing a tree.
+type Entry struct {
+	Path string // slash-separated and relative to the root, which is "."
+	Mode fs.FileMode
+	Hash cityhash.Uint128
+}
+
+// String formats the entry as a manifest line: the hash as 32 hex digits,
+// high 64 bits first, then the mode and the path.
+func (this Entry) String() string {
+	return fmt.Sprintf("%016x%016x  %v  %s", this.Hash.Higher64(), this.Hash.Lower64(), this.Mode, this.Path)
+}
+
+// Hash returns the fingerprint of the tree rooted at root together with all
+// entries that went into it, depth first with names in byte order. A nil
+// opts hashes everything and does not follow symbolic links.
+func Hash(root string, opts *Options) (cityhash.Uint128, []Entry, error) {
+	w := &walker{}
+	if opts != nil {
+		w.opts = *opts
+	}
+
+	for _, pattern := range w.opts.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return cityhash.Uint128{}, nil, fmt.Errorf("dirhash: bad exclude pattern %q", pattern)
+		}
+	}
+
+	info, err := w.stat(root)
+	if err != nil {
+		return cityhash.Uint128{}, nil, err
+	}
+
+	h, err := w.hash(root, ".", info)
+	if err != nil {
+		return cityhash.Uint128{}, nil, err
+	}
+
+	return h, w.entries, nil
+}
+
+// WriteManifest writes one line per entry to w.
+func WriteManifest(w io.Writer, entries []Entry) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprintln(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type walker struct {
+	opts    Options
+	entries []Entry
+	parents []string // resolved directories being walked, to catch cycles
+}
+
+func (this *walker) stat(name string) (fs.FileInfo, error) {
+	if this.opts.FollowSymlinks {
+		return os.Stat(name)
+	}
+	return os.Lstat(name)
+}
+
+func (this *walker) excluded(rel string) bool {
+	for _, pattern := range this.opts.Exclude {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func mode(info fs.FileInfo) fs.FileMode {
+	return info.Mode() & (fs.ModeType | fs.ModePerm)
+}
+
+func (this *walker) hash(name, rel string, info fs.FileInfo) (cityhash.Uint128, error) {
+	i := len(this.entries)
+	this.entries = append(this.entries, Entry{Path: rel, Mode: mode(info)})
+
+	var h cityhash.Uint128
+	var err error
+
+	switch {
+	case info.IsDir():
+		h, err = this.hashDir(name, rel)
+	case info.Mode().IsRegular():
+		h, err = hashFile(name)
+	case info.Mode()&fs.ModeSymlink != 0:
+		var target string
+		if target, err = os.Readlink(name); err == nil {
+			h = cityhash.CityHash128([]byte(target), uint32(len(target)))
+		}
+	default:
+		h = cityhash.CityHash128(nil, 0)
+	}
+	if err != nil {
+		return cityhash.Uint128{}, err
+	}
+
+	this.entries[i].Hash = h
+	return h, nil
+}
+
+func (this *walker) hashDir(name, rel string) (cityhash.Uint128, error) {
+	if this.opts.FollowSymlinks {
+		resolved, err := filepath.EvalSymlinks(name)
+		if err != nil {
+			return cityhash.Uint128{}, err
+		}
+		for _, p := range this.parents {
+			if p == resolved {
+				return cityhash.Uint128{}, fmt.Errorf("dirhash: %s: symbolic link cycle", name)
+			}
+		}
+		this.parents = append(this.parents, resolved)
+		defer func() { this.parents = this.parents[:len(this.parents)-1] }()
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return cityhash.Uint128{}, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return cityhash.Uint128{}, err
+	}
+	sort.Strings(names)
+
+	var records []byte
+	var m [4]byte
+	for _, n := range names {
+		childRel := path.Join(rel, n)
+		if this.excluded(childRel) {
+			continue
+		}
+
+		child := filepath.Join(name, n)
+		info, err := this.stat(child)
+		if err != nil {
+			return cityhash.Uint128{}, err
+		}
+
+		h, err := this.hash(child, childRel, info)
+		if err != nil {
+			return cityhash.Uint128{}, err
+		}
+
+		binary.LittleEndian.PutUint32(m[:], uint32(mode(info)))
+		records = append(records, n...)
+		records = append(records, 0)
+		records = append(records, m[:]...)
+		records = append(records, h.Bytes()...)
+	}
+
+	return cityhash.CityHash128(records, uint32(len(records))), nil
+}
+
+func hashFile(name string) (cityhash.Uint128, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return cityhash.Uint128{}, err
+	}
+	defer f.Close()
+
+	return cityhash.HashReader128Context(context.Background(), f, nil)
+}
@@ -0,0 +1,128 @@
+package dirhash
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zentures/cityhash"
+)
+
+func writeTree(t *testing.T) string {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.txt":     "alpha",
+		"sub/b.txt": "beta",
+		"sub/c.log": "noise",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Don't let the umask decide the modes being hashed.
+		os.Chmod(p, 0644)
+	}
+	os.Chmod(filepath.Join(dir, "sub"), 0755)
+	return dir
+}
+
+func record(name string, mode os.FileMode, h cityhash.Uint128) []byte {
+	b := append([]byte(name), 0)
+	b = binary.LittleEndian.AppendUint32(b, uint32(mode))
+	return append(b, h.Bytes()...)
+}
+
+func hash128(s string) cityhash.Uint128 {
+	return cityhash.CityHash128([]byte(s), uint32(len(s)))
+}
+
+func TestHash(t *testing.T) {
+	dir := writeTree(t)
+
+	h, entries, err := Hash(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sub []byte
+	sub = append(sub, record("b.txt", 0644, hash128("beta"))...)
+	sub = append(sub, record("c.log", 0644, hash128("noise"))...)
+	var root []byte
+	root = append(root, record("a.txt", 0644, hash128("alpha"))...)
+	root = append(root, record("sub", os.ModeDir|0755, cityhash.CityHash128(sub, uint32(len(sub))))...)
+
+	if expected := cityhash.CityHash128(root, uint32(len(root))); h != expected {
+		t.Errorf("ERROR: expected %v but got %v", expected, h)
+	}
+
+	paths := []string{".", "a.txt", "sub", "sub/b.txt", "sub/c.log"}
+	if len(entries) != len(paths) {
+		t.Fatalf("ERROR: expected %d entries but got %d", len(paths), len(entries))
+	}
+	for i, p := range paths {
+		if entries[i].Path != p {
+			t.Errorf("ERROR: expected entry %d to be %s but got %s", i, p, entries[i].Path)
+		}
+	}
+	if entries[0].Hash != h {
+		t.Errorf("ERROR: expected the root entry to carry the fingerprint")
+	}
+
+	// Excluding by name and by path gives the tree without the file.
+	excluded, _, err := Hash(dir, &Options{Exclude: []string{"*.log"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "sub", "c.log"))
+	without, _, err := Hash(dir, &Options{Exclude: []string{"sub/nothing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if excluded != without || excluded == h {
+		t.Errorf("ERROR: expected excluding c.log to equal removing it")
+	}
+
+	// Permission changes show up in the fingerprint.
+	os.Chmod(filepath.Join(dir, "a.txt"), 0600)
+	if changed, _, _ := Hash(dir, nil); changed == without {
+		t.Errorf("ERROR: expected a mode change to change the fingerprint")
+	}
+
+	if _, _, err = Hash(dir, &Options{Exclude: []string{"["}}); err == nil {
+		t.Errorf("ERROR: expected an error for a bad pattern")
+	}
+}
+
+func TestHashSymlinks(t *testing.T) {
+	dir := writeTree(t)
+	if err := os.Symlink("sub", filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+
+	_, entries, err := Hash(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := entries[2]; e.Path != "link" || e.Mode&os.ModeSymlink == 0 || e.Hash != hash128("sub") {
+		t.Errorf("ERROR: expected link to be hashed as a symbolic link but got %v", e)
+	}
+
+	_, entries, err = Hash(dir, &Options{FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := entries[2]; e.Path != "link" || !e.Mode.IsDir() || e.Hash != entries[5].Hash {
+		t.Errorf("ERROR: expected link to be hashed like sub but got %v", e)
+	}
+
+	if err = os.Symlink("..", filepath.Join(dir, "sub", "up")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Hash(dir, &Options{FollowSymlinks: true}); err == nil {
+		t.Errorf("ERROR: expected an error for a symbolic link cycle")
+	}
+}
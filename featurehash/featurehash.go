@@ -0,0 +1,193 @@
+// Package featurehash maps named features to indexes of a fixed-size sparse
+// vector, the hashing trick of Weinberger et al., "Feature Hashing for Large
+// Scale Multitask Learning", with namespaces and quadratic interactions in
+// the manner of Vowpal Wabbit.
+//
+// A namespace has a seed: zero for the default namespace "", and otherwise
+// the hash of its name. With b bits, a feature in a namespace with seed s
+// gets the index h & (2^b - 1) and the sign -1 if the top bit of g is set,
+// where for a 64-bit Hasher
+//
+//	s = CityHash64(namespace)
+//	h = CityHash64WithSeed(feature, s)
+//	g = CityHash64WithSeed(feature, s ^ SignSeed)
+//
+// and for a 32-bit Hasher, with le(x) the four little endian bytes of x,
+//
+//	s = CityHash32(namespace)
+//	h = CityHash32(le(s) + feature)
+//	g = CityHash32(le(s ^ SignSeed&0xffffffff) + feature)
+//
+// The pair of features with hashes h1 and h2 from an interaction of two
+// namespaces gets the index (h1 * 16777619) ^ h2, masked likewise, and the
+// product of their signs and values.
+package featurehash
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/zentures/cityhash"
+)
+
+// SignSeed makes the sign hash independent of the index hash.
+const SignSeed = 0x2545f4914f6cdd1d
+
+// interactionPrime is the FNV prime Vowpal Wabbit combines hashes with.
+const interactionPrime = 16777619
+
+var ErrBits = errors.New("featurehash: bits out of range")
+
+// Feature is a feature and its value; a categorical feature is usually named
+// "name=value" with value 1.
+type Feature struct {
+	Name  string
+	Value float64
+}
+
+// Namespace is a named group of features.
+type Namespace struct {
+	Name     string
+	Features []Feature
+}
+
+// SparseVector holds the non-zero entries of a vector, in increasing order of
+// index.
+type SparseVector struct {
+	Indices []uint64
+	Values  []float64
+}
+
+// Dot returns the dot product with a dense vector of weights.
+func (this SparseVector) Dot(weights []float64) float64 {
+	sum := 0.0
+	for i, idx := range this.Indices {
+		sum += this.Values[i] * weights[idx]
+	}
+	return sum
+}
+
+// Hasher maps features to indexes in [0, 2^bits). It is immutable after
+// setting up interactions and safe for concurrent use.
+type Hasher struct {
+	bits         uint
+	wide         bool // CityHash64 rather than CityHash32
+	interactions [][2]string
+}
+
+// New returns a Hasher over 2^bits indexes, 1 <= bits <= 32, that uses
+// CityHash32.
+func New(bits int) (*Hasher, error) {
+	if bits < 1 || bits > 32 {
+		return nil, ErrBits
+	}
+	return &Hasher{bits: uint(bits)}, nil
+}
+
+// New64 returns a Hasher over 2^bits indexes, 1 <= bits <= 64, that uses
+// CityHash64.
+func New64(bits int) (*Hasher, error) {
+	if bits < 1 || bits > 64 {
+		return nil, ErrBits
+	}
+	return &Hasher{bits: uint(bits), wide: true}, nil
+}
+
+// Bits returns the number of index bits.
+func (this *Hasher) Bits() int {
+	return int(this.bits)
+}
+
+// Interact adds the quadratic interaction of namespaces a and b to Vectorize.
+func (this *Hasher) Interact(a, b string) {
+	this.interactions = append(this.interactions, [2]string{a, b})
+}
+
+func (this *Hasher) mask() uint64 {
+	if this.bits == 64 {
+		return ^uint64(0)
+	}
+	return 1<<this.bits - 1
+}
+
+// seed returns the seed of a namespace.
+func (this *Hasher) seed(namespace string) uint64 {
+	if namespace == "" {
+		return 0
+	}
+	if this.wide {
+		return cityhash.CityHash64([]byte(namespace), uint32(len(namespace)))
+	}
+	return uint64(cityhash.CityHash32([]byte(namespace), uint32(len(namespace))))
+}
+
+// hash returns the unmasked hash of feature under seed and its sign.
+func (this *Hasher) hash(seed uint64, feature string) (uint64, float64) {
+	var h, g uint64
+	if this.wide {
+		h = cityhash.CityHash64WithSeed([]byte(feature), uint32(len(feature)), seed)
+		g = cityhash.CityHash64WithSeed([]byte(feature), uint32(len(feature)), seed^SignSeed) >> 63
+	} else {
+		b := make([]byte, 4+len(feature))
+		copy(b[4:], feature)
+		binary.LittleEndian.PutUint32(b, uint32(seed))
+		h = uint64(cityhash.CityHash32(b, uint32(len(b))))
+		binary.LittleEndian.PutUint32(b, uint32(seed)^uint32(SignSeed&0xffffffff))
+		g = uint64(cityhash.CityHash32(b, uint32(len(b)))) >> 31
+	}
+
+	if g != 0 {
+		return h, -1
+	}
+	return h, 1
+}
+
+// Index returns the index and sign of a feature in a namespace.
+func (this *Hasher) Index(namespace, feature string) (uint64, float64) {
+	h, sign := this.hash(this.seed(namespace), feature)
+	return h & this.mask(), sign
+}
+
+// Vectorize hashes the features of every namespace, and the pairs of
+// features of the interactions, into a sparse vector. Entries that collide
+// are summed.
+func (this *Hasher) Vectorize(namespaces []Namespace) SparseVector {
+	type hashed struct {
+		h     uint64
+		value float64 // value times sign
+	}
+
+	mask := this.mask()
+	entries := make(map[uint64]float64)
+	byName := make(map[string][]hashed)
+
+	for _, ns := range namespaces {
+		seed := this.seed(ns.Name)
+		for _, f := range ns.Features {
+			h, sign := this.hash(seed, f.Name)
+			entries[h&mask] += sign * f.Value
+			byName[ns.Name] = append(byName[ns.Name], hashed{h, sign * f.Value})
+		}
+	}
+
+	for _, pair := range this.interactions {
+		for _, a := range byName[pair[0]] {
+			for _, b := range byName[pair[1]] {
+				entries[(a.h*interactionPrime^b.h)&mask] += a.value * b.value
+			}
+		}
+	}
+
+	var v SparseVector
+	for idx, value := range entries {
+		if value != 0 {
+			v.Indices = append(v.Indices, idx)
+		}
+	}
+	sort.Slice(v.Indices, func(i, j int) bool { return v.Indices[i] < v.Indices[j] })
+	for _, idx := range v.Indices {
+		v.Values = append(v.Values, entries[idx])
+	}
+	return v
+}
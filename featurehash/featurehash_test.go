@@ -0,0 +1,105 @@
+package featurehash
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/zentures/cityhash"
+)
+
+// fixtures pin indexes that models trained offline depend on.
+var fixtures = []struct {
+	namespace, feature string
+	index32            uint64
+	sign32             float64
+	index64            uint64
+	sign64             float64
+}{
+	{"", "price", 75431, -1, 8241270, -1},
+	{"user", "age", 40069, -1, 11396789, 1},
+	{"user", "country=NZ", 30381, -1, 7181649, -1},
+	{"item", "id=12345", 132089, 1, 15289957, -1},
+}
+
+func TestIndex(t *testing.T) {
+	if _, err := New(33); err != ErrBits {
+		t.Errorf("ERROR: expected ErrBits but got %v", err)
+	}
+	if _, err := New64(0); err != ErrBits {
+		t.Errorf("ERROR: expected ErrBits but got %v", err)
+	}
+
+	h32, _ := New(18)
+	h64, _ := New64(24)
+	for _, f := range fixtures {
+		if i, s := h32.Index(f.namespace, f.feature); i != f.index32 || s != f.sign32 {
+			t.Errorf("ERROR: %s/%s: expected %d, %v but got %d, %v", f.namespace, f.feature, f.index32, f.sign32, i, s)
+		}
+		if i, s := h64.Index(f.namespace, f.feature); i != f.index64 || s != f.sign64 {
+			t.Errorf("ERROR: %s/%s: expected %d, %v but got %d, %v", f.namespace, f.feature, f.index64, f.sign64, i, s)
+		}
+	}
+
+	// The documented formula for the default namespace.
+	if i, _ := h64.Index("", "price"); i != cityhash.CityHash64WithSeed([]byte("price"), 5, 0)&(1<<24-1) {
+		t.Errorf("ERROR: expected the default namespace to use seed 0")
+	}
+
+	// Signs are balanced and indexes spread over the range.
+	var sum float64
+	used := map[uint64]bool{}
+	for i := 0; i < 10000; i++ {
+		idx, sign := h32.Index("ns", fmt.Sprintf("f%d", i))
+		if idx >= 1<<18 {
+			t.Fatalf("ERROR: index %d out of range", idx)
+		}
+		used[idx] = true
+		sum += sign
+	}
+	if math.Abs(sum) > 300 || len(used) < 9700 {
+		t.Errorf("ERROR: expected balanced signs and few collisions but got sum %v and %d indexes", sum, len(used))
+	}
+}
+
+func TestVectorize(t *testing.T) {
+	h, _ := New(18)
+	h.Interact("user", "item")
+
+	v := h.Vectorize([]Namespace{
+		{"user", []Feature{{"age", 0.5}, {"country=NZ", 1}}},
+		{"item", []Feature{{"id=12345", 1}, {"id=12345", 1}}},
+	})
+
+	expected := map[uint64]float64{}
+	for _, f := range []struct {
+		ns, name string
+		value    float64
+	}{{"user", "age", 0.5}, {"user", "country=NZ", 1}, {"item", "id=12345", 2}} {
+		idx, sign := h.Index(f.ns, f.name)
+		expected[idx] += sign * f.value
+	}
+	if len(v.Indices) != 5 || len(v.Values) != 5 {
+		t.Fatalf("ERROR: expected 3 features and 2 interactions but got %v", v)
+	}
+	for i, idx := range v.Indices {
+		if i > 0 && idx <= v.Indices[i-1] {
+			t.Errorf("ERROR: expected increasing indexes but got %v", v.Indices)
+		}
+		if e, ok := expected[idx]; ok && e != v.Values[i] {
+			t.Errorf("ERROR: expected %v at %d but got %v", e, idx, v.Values[i])
+		}
+	}
+
+	weights := make([]float64, 1<<18)
+	for _, idx := range v.Indices {
+		weights[idx] = 1
+	}
+	var sum float64
+	for _, value := range v.Values {
+		sum += value
+	}
+	if v.Dot(weights) != sum {
+		t.Errorf("ERROR: expected dot product %v but got %v", sum, v.Dot(weights))
+	}
+}
@@ -0,0 +1,48 @@
+package cityhash
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestHashers(t *testing.T) {
+	setup()
+
+	for _, length := range []int{0, 3, 17, 100, 300, 4096} {
+		s := data[:length]
+
+		h32 := New32()
+		h64 := New64()
+		h64s := New64WithSeed(kSeed0)
+		h64ss := New64WithSeeds(kSeed0, kSeed1)
+		h128 := New128()
+		h128s := New128WithSeed(kSeed128)
+
+		// Feed the hashers in two pieces to exercise buffering.
+		for _, p := range [][]byte{s[:length/2], s[length/2:]} {
+			h32.Write(p)
+			h64.Write(p)
+			h64s.Write(p)
+			h64ss.Write(p)
+			h128.Write(p)
+			h128s.Write(p)
+		}
+
+		check(uint64(CityHash32(s, uint32(length))), uint64(h32.Sum32()), t)
+		check(CityHash64(s, uint32(length)), h64.Sum64(), t)
+		check(CityHash64WithSeed(s, uint32(length), kSeed0), h64s.Sum64(), t)
+		check(CityHash64WithSeeds(s, uint32(length), kSeed0, kSeed1), h64ss.Sum64(), t)
+
+		u := CityHash128(s, uint32(length))
+		check(u.Lower64(), h128.Sum128().Lower64(), t)
+		check(u.Higher64(), h128.Sum128().Higher64(), t)
+
+		sum := h128.Sum(nil)
+		check(u.Higher64(), binary.BigEndian.Uint64(sum), t)
+		check(u.Lower64(), binary.BigEndian.Uint64(sum[8:]), t)
+
+		v := CityHash128WithSeed(s, uint32(length), kSeed128)
+		check(v.Lower64(), h128s.Sum128().Lower64(), t)
+		check(v.Higher64(), h128s.Sum128().Higher64(), t)
+	}
+}
@@ -0,0 +1,309 @@
+// Package hll implements a HyperLogLog++ cardinality sketch fed by CityHash64,
+// after Heule et al., "HyperLogLog in Practice".
+//
+// Small sketches keep a sparse list of (index, rank) pairs at precision 25
+// and estimate with linear counting; once that list outgrows the dense form
+// they switch to 2^p six-bit registers. Instead of the empirical bias tables
+// of the paper, the dense estimate uses Ertl's improved raw estimator ("New
+// cardinality estimation algorithms for HyperLogLog sketches"), which is
+// free of that bias over the whole range.
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/zentures/cityhash"
+)
+
+const (
+	MinPrecision = 4
+	MaxPrecision = 18
+
+	sparsePrecision = 25
+)
+
+var (
+	ErrPrecision    = errors.New("hll: precision out of range")
+	ErrIncompatible = errors.New("hll: sketches have different precisions")
+	ErrInvalid      = errors.New("hll: invalid encoding")
+)
+
+// Sketch is a HyperLogLog++ sketch. It is not safe for concurrent use.
+type Sketch struct {
+	p         uint8
+	sparse    map[uint32]uint8 // index at precision 25 to rank; nil once dense
+	registers []uint8          // 2^p ranks once dense
+}
+
+// New returns an empty sketch of precision p, which uses 2^p registers and
+// has a relative standard error of about 1.04/sqrt(2^p).
+func New(p uint8) (*Sketch, error) {
+	if p < MinPrecision || p > MaxPrecision {
+		return nil, ErrPrecision
+	}
+	return &Sketch{p: p, sparse: make(map[uint32]uint8)}, nil
+}
+
+func (this *Sketch) Precision() uint8 {
+	return this.p
+}
+
+// Sparse reports whether the sketch still uses the sparse representation.
+func (this *Sketch) Sparse() bool {
+	return this.sparse != nil
+}
+
+// Add adds key, hashed with CityHash64.
+func (this *Sketch) Add(key []byte) {
+	this.AddHash(cityhash.CityHash64(key, uint32(len(key))))
+}
+
+// AddHash adds an item by its CityHash64 value, for callers that already
+// hold it.
+func (this *Sketch) AddHash(h uint64) {
+	if this.sparse != nil {
+		idx := uint32(h >> (64 - sparsePrecision))
+		rank := rank(h, sparsePrecision)
+		if rank > this.sparse[idx] {
+			this.sparse[idx] = rank
+		}
+		if len(this.sparse) > this.sparseLimit() {
+			this.toDense()
+		}
+		return
+	}
+
+	idx := h >> (64 - this.p)
+	if r := rank(h, this.p); r > this.registers[idx] {
+		this.registers[idx] = r
+	}
+}
+
+// rank is one more than the number of leading zeros of h after its first p
+// bits, at most 64-p+1.
+func rank(h uint64, p uint8) uint8 {
+	return uint8(bits.LeadingZeros64(h<<p|1<<(p-1))) + 1
+}
+
+// sparseLimit is the number of sparse entries, at four bytes each, that
+// take the space of the dense registers.
+func (this *Sketch) sparseLimit() int {
+	return 1 << this.p / 4
+}
+
+func (this *Sketch) toDense() {
+	this.registers = make([]uint8, 1<<this.p)
+	for idx, r := range this.sparse {
+		i, r := denseRank(idx, r, this.p)
+		if r > this.registers[i] {
+			this.registers[i] = r
+		}
+	}
+	this.sparse = nil
+}
+
+// denseRank converts a sparse entry to a register index and rank at
+// precision p.
+func denseRank(idx uint32, r uint8, p uint8) (uint32, uint8) {
+	shift := sparsePrecision - p
+	low := idx & (1<<shift - 1)
+	if low != 0 {
+		return idx >> shift, shift - uint8(bits.Len32(low)) + 1
+	}
+	return idx >> shift, shift + r
+}
+
+// Estimate returns the estimated number of distinct items added.
+func (this *Sketch) Estimate() uint64 {
+	if this.sparse != nil {
+		// Linear counting over the 2^25 sparse buckets.
+		m := float64(uint64(1) << sparsePrecision)
+		return uint64(math.Round(m * math.Log(m/(m-float64(len(this.sparse))))))
+	}
+
+	q := 64 - int(this.p)
+	counts := make([]float64, q+2)
+	for _, r := range this.registers {
+		counts[r]++
+	}
+
+	m := float64(len(this.registers))
+	z := m * tau(1-counts[q+1]/m)
+	for k := q; k >= 1; k-- {
+		z = 0.5 * (z + counts[k])
+	}
+	z += m * sigma(counts[0]/m)
+
+	return uint64(math.Round(m * m / (2 * math.Ln2) / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if z == prev {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
+
+// Merge adds all items of other, which must have the same precision. The
+// result is the sketch that adding both streams to one sketch would give.
+func (this *Sketch) Merge(other *Sketch) error {
+	if this.p != other.p {
+		return ErrIncompatible
+	}
+
+	if this.sparse != nil && other.sparse != nil {
+		for idx, r := range other.sparse {
+			if r > this.sparse[idx] {
+				this.sparse[idx] = r
+			}
+		}
+		if len(this.sparse) > this.sparseLimit() {
+			this.toDense()
+		}
+		return nil
+	}
+
+	if this.sparse != nil {
+		this.toDense()
+	}
+	if other.sparse != nil {
+		for idx, r := range other.sparse {
+			i, r := denseRank(idx, r, this.p)
+			if r > this.registers[i] {
+				this.registers[i] = r
+			}
+		}
+		return nil
+	}
+
+	for i, r := range other.registers {
+		if r > this.registers[i] {
+			this.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// The encoding is, little endian throughout:
+//
+//	magic     [4]byte "CHLL"
+//	version   uint8   1
+//	precision uint8
+//	format    uint8   0 sparse, 1 dense
+//	          uint8   reserved, zero
+//
+// followed for a sparse sketch by a uint32 count and that many uint32
+// entries index<<6 | rank in increasing order, and for a dense sketch by the
+// 2^precision registers, one byte each.
+const headerSize = 8
+
+var magic = [4]byte{'C', 'H', 'L', 'L'}
+
+func (this *Sketch) MarshalBinary() ([]byte, error) {
+	b := append([]byte(nil), magic[:]...)
+
+	if this.sparse == nil {
+		b = append(b, 1, this.p, 1, 0)
+		return append(b, this.registers...), nil
+	}
+
+	entries := make([]uint32, 0, len(this.sparse))
+	for idx, r := range this.sparse {
+		entries = append(entries, idx<<6|uint32(r))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i] < entries[j] })
+
+	b = append(b, 1, this.p, 0, 0)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(entries)))
+	for _, e := range entries {
+		b = binary.LittleEndian.AppendUint32(b, e)
+	}
+	return b, nil
+}
+
+func (this *Sketch) UnmarshalBinary(b []byte) error {
+	if len(b) < headerSize || [4]byte(b[:4]) != magic || b[4] != 1 {
+		return ErrInvalid
+	}
+
+	p, format := b[5], b[6]
+	if p < MinPrecision || p > MaxPrecision {
+		return ErrInvalid
+	}
+	b = b[headerSize:]
+	s := Sketch{p: p}
+
+	switch format {
+	case 0:
+		if len(b) < 4 {
+			return ErrInvalid
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(len(b)-4) != 4*uint64(n) {
+			return ErrInvalid
+		}
+
+		s.sparse = make(map[uint32]uint8, n)
+		for i := uint32(0); i < n; i++ {
+			e := binary.LittleEndian.Uint32(b[4+4*i:])
+			idx, r := e>>6, uint8(e&63)
+			if idx >= 1<<sparsePrecision || r == 0 || r > 64-sparsePrecision+1 {
+				return ErrInvalid
+			}
+			// Indexes must be strictly increasing, which also rules out
+			// duplicates.
+			if i > 0 && idx <= binary.LittleEndian.Uint32(b[4*i:])>>6 {
+				return ErrInvalid
+			}
+			s.sparse[idx] = r
+		}
+
+	case 1:
+		if len(b) != 1<<p {
+			return ErrInvalid
+		}
+		for _, r := range b {
+			if r > 64-p+1 {
+				return ErrInvalid
+			}
+		}
+		s.registers = append([]uint8(nil), b...)
+
+	default:
+		return ErrInvalid
+	}
+
+	*this = s
+	return nil
+}
@@ -0,0 +1,134 @@
+package hll
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("user-%d", i))
+}
+
+func TestEstimate(t *testing.T) {
+	for _, p := range []uint8{10, 14} {
+		s, err := New(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stderr := 1.04 / math.Sqrt(float64(uint(1)<<p))
+
+		n := 0
+		for _, target := range []int{0, 10, 100, 1000, 10000, 100000, 1000000} {
+			for ; n < target; n++ {
+				s.Add(key(n))
+				s.Add(key(n / 2)) // duplicates don't count
+			}
+
+			est := float64(s.Estimate())
+			if n == 0 && est != 0 {
+				t.Errorf("ERROR: p=%d: expected 0 for an empty sketch but got %v", p, est)
+			}
+			if n > 0 && math.Abs(est-float64(n))/float64(n) > 4*stderr {
+				t.Errorf("ERROR: p=%d: expected about %d but got %v (sparse %v)", p, n, est, s.Sparse())
+			}
+		}
+		if s.Sparse() {
+			t.Errorf("ERROR: p=%d: expected the sketch to be dense after a million items", p)
+		}
+	}
+
+	if _, err := New(3); err != ErrPrecision {
+		t.Errorf("ERROR: expected ErrPrecision but got %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	for _, sizes := range [][2]int{{100, 200}, {100, 50000}, {50000, 100}, {50000, 60000}} {
+		a, _ := New(12)
+		b, _ := New(12)
+		all, _ := New(12)
+
+		for i := 0; i < sizes[0]; i++ {
+			a.Add(key(i))
+			all.Add(key(i))
+		}
+		for i := 0; i < sizes[1]; i++ {
+			b.Add(key(i + sizes[0]/2))
+			all.Add(key(i + sizes[0]/2))
+		}
+
+		if err := a.Merge(b); err != nil {
+			t.Fatal(err)
+		}
+
+		// Merging must be lossless: it ends where adding everything does.
+		ab, _ := a.MarshalBinary()
+		allb, _ := all.MarshalBinary()
+		if string(ab) != string(allb) {
+			t.Errorf("ERROR: %v: expected the merged sketch to equal the combined one", sizes)
+		}
+	}
+
+	a, _ := New(12)
+	b, _ := New(13)
+	if err := a.Merge(b); err != ErrIncompatible {
+		t.Errorf("ERROR: expected ErrIncompatible but got %v", err)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	for _, n := range []int{0, 50, 100000} {
+		s, _ := New(12)
+		for i := 0; i < n; i++ {
+			s.Add(key(i))
+		}
+
+		b, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var d Sketch
+		if err = d.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		if d.Estimate() != s.Estimate() || d.Sparse() != s.Sparse() {
+			t.Errorf("ERROR: %d items: expected estimate %d but got %d", n, s.Estimate(), d.Estimate())
+		}
+
+		c, _ := d.MarshalBinary()
+		if string(b) != string(c) {
+			t.Errorf("ERROR: %d items: expected re-encoding to give the same bytes", n)
+		}
+
+		if err = d.UnmarshalBinary(b[:len(b)-1]); err != ErrInvalid && n > 0 {
+			t.Errorf("ERROR: %d items: expected ErrInvalid for a truncated sketch but got %v", n, err)
+		}
+	}
+
+	// Sparse entries must have indexes below 2^25, in increasing order.
+	sparse := func(entries ...uint32) []byte {
+		b := append(magic[:], 1, 10, 0, 0)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(entries)))
+		for _, e := range entries {
+			b = binary.LittleEndian.AppendUint32(b, e)
+		}
+		return b
+	}
+
+	var d Sketch
+	if err := d.UnmarshalBinary(sparse(5<<6|1, 9<<6|2)); err != nil {
+		t.Errorf("ERROR: expected a valid sparse sketch to decode but got %v", err)
+	}
+	for _, entries := range [][]uint32{
+		{0x3ffffff<<6 | 1},
+		{1<<25<<6 | 1},
+		{9<<6 | 2, 5<<6 | 1},
+		{5<<6 | 1, 5<<6 | 2},
+	} {
+		if err := d.UnmarshalBinary(sparse(entries...)); err != ErrInvalid {
+			t.Errorf("ERROR: expected ErrInvalid for entries %x but got %v", entries, err)
+		}
+	}
+}
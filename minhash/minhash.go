@@ -0,0 +1,227 @@
+// Package minhash computes MinHash signatures of shingled documents with
+// CityHash64WithSeed and indexes them for near-duplicate search with banded
+// locality-sensitive hashing.
+package minhash
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/zentures/cityhash"
+)
+
+// ByteShingles returns the n-byte substrings of data. Inputs shorter than n
+// give a single shingle, the input itself.
+func ByteShingles(data []byte, n int) [][]byte {
+	if len(data) <= n {
+		return [][]byte{data}
+	}
+
+	shingles := make([][]byte, 0, len(data)-n+1)
+	for i := 0; i+n <= len(data); i++ {
+		shingles = append(shingles, data[i:i+n])
+	}
+	return shingles
+}
+
+// TokenShingles returns the runs of n consecutive tokens, joined by a space.
+func TokenShingles(tokens []string, n int) [][]byte {
+	if len(tokens) <= n {
+		return [][]byte{[]byte(strings.Join(tokens, " "))}
+	}
+
+	shingles := make([][]byte, 0, len(tokens)-n+1)
+	for i := 0; i+n <= len(tokens); i++ {
+		shingles = append(shingles, []byte(strings.Join(tokens[i:i+n], " ")))
+	}
+	return shingles
+}
+
+// Signature is a MinHash signature. Signatures are only comparable if they
+// come from Hashers with the same size, seed and scheme.
+type Signature []uint64
+
+// Hasher computes MinHash signatures of k values.
+type Hasher struct {
+	k       int
+	seeds   []uint64 // one per permutation, or a single one
+	onePerm bool
+}
+
+// New returns a Hasher that takes the minimum of k independently seeded
+// hashes of the shingles. It costs k hashes per shingle.
+func New(k int, seed uint64) *Hasher {
+	seeds := make([]uint64, k)
+	for i := range seeds {
+		seed = splitmix(seed)
+		seeds[i] = seed
+	}
+	return &Hasher{k: k, seeds: seeds}
+}
+
+// NewOnePermutation returns a Hasher that hashes each shingle once and keeps
+// the minimum per bin of k bins (Li et al., "One Permutation Hashing"). Empty
+// bins borrow from the next non-empty bin to their right, offset by the
+// distance, after Shrivastava and Li, "Densifying One Permutation Hashing via
+// Rotation".
+func NewOnePermutation(k int, seed uint64) *Hasher {
+	return &Hasher{k: k, seeds: []uint64{splitmix(seed)}, onePerm: true}
+}
+
+func splitmix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// Sum returns the signature of a set of shingles.
+func (this *Hasher) Sum(shingles [][]byte) Signature {
+	sig := make(Signature, this.k)
+	for i := range sig {
+		sig[i] = math.MaxUint64
+	}
+
+	if !this.onePerm {
+		for _, s := range shingles {
+			for i, seed := range this.seeds {
+				if h := cityhash.CityHash64WithSeed(s, uint32(len(s)), seed); h < sig[i] {
+					sig[i] = h
+				}
+			}
+		}
+		return sig
+	}
+
+	filled := make([]bool, this.k)
+	for _, s := range shingles {
+		h := cityhash.CityHash64WithSeed(s, uint32(len(s)), this.seeds[0])
+		bin, _ := bits.Mul64(h, uint64(this.k))
+		if h <= sig[bin] {
+			sig[bin], filled[bin] = h, true
+		}
+	}
+
+	for i := range sig {
+		if filled[i] {
+			continue
+		}
+		for d := 1; d < this.k; d++ {
+			if j := (i + d) % this.k; filled[j] {
+				sig[i] = sig[j] + uint64(d)*0x9e3779b97f4a7c15
+				break
+			}
+		}
+	}
+	return sig
+}
+
+// Similarity estimates the Jaccard similarity of the sets behind a and b as
+// the fraction of positions where they agree.
+func Similarity(a, b Signature) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	n := 0
+	for i := range a {
+		if a[i] == b[i] {
+			n++
+		}
+	}
+	return float64(n) / float64(len(a))
+}
+
+// LSH is a banded locality-sensitive hashing index. A signature is split into
+// b bands of r values, and two signatures are candidates if any band is
+// equal. It is not safe for concurrent use.
+type LSH struct {
+	bands, rows int
+	tables      []map[uint64][]string
+}
+
+// NewLSH returns an index for signatures of k values that finds pairs with a
+// Jaccard similarity of at least threshold. It chooses the number of bands
+// and rows that minimises the sum of the false positive and false negative
+// probabilities around the threshold.
+func NewLSH(k int, threshold float64) *LSH {
+	bestB, bestR, best := 1, k, math.Inf(1)
+	for b := 1; b <= k; b++ {
+		for r := 1; b*r <= k; r++ {
+			fp := integrate(func(s float64) float64 { return candidate(s, b, r) }, 0, threshold)
+			fn := integrate(func(s float64) float64 { return 1 - candidate(s, b, r) }, threshold, 1)
+			if fp+fn < best {
+				bestB, bestR, best = b, r, fp+fn
+			}
+		}
+	}
+	return NewLSHWithBands(bestB, bestR)
+}
+
+// NewLSHWithBands returns an index of b bands of r values each, for
+// signatures of at least b*r values.
+func NewLSHWithBands(b, r int) *LSH {
+	tables := make([]map[uint64][]string, b)
+	for i := range tables {
+		tables[i] = make(map[uint64][]string)
+	}
+	return &LSH{bands: b, rows: r, tables: tables}
+}
+
+// candidate is the probability that signatures of similarity s share a band.
+func candidate(s float64, b, r int) float64 {
+	return 1 - math.Pow(1-math.Pow(s, float64(r)), float64(b))
+}
+
+func integrate(f func(float64) float64, a, b float64) float64 {
+	const steps = 100
+	step := (b - a) / steps
+	area := 0.0
+	for i := 0; i < steps; i++ {
+		x := a + (float64(i)+0.5)*step
+		area += f(x) * step
+	}
+	return area
+}
+
+// Bands returns the number of bands and the rows in each.
+func (this *LSH) Bands() (b, r int) {
+	return this.bands, this.rows
+}
+
+func (this *LSH) bandKey(sig Signature, band int) uint64 {
+	buf := make([]byte, 8*this.rows)
+	for i, v := range sig[band*this.rows : (band+1)*this.rows] {
+		binary.LittleEndian.PutUint64(buf[8*i:], v)
+	}
+	return cityhash.CityHash64(buf, uint32(len(buf)))
+}
+
+// Insert adds the signature of the document id.
+func (this *LSH) Insert(id string, sig Signature) {
+	for band := range this.tables {
+		key := this.bandKey(sig, band)
+		this.tables[band][key] = append(this.tables[band][key], id)
+	}
+}
+
+// Query returns the ids of the documents sharing a band with sig, sorted.
+// Candidates should be confirmed with Similarity.
+func (this *LSH) Query(sig Signature) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for band := range this.tables {
+		for _, id := range this.tables[band][this.bandKey(sig, band)] {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	sort.Strings(ids)
+	return ids
+}
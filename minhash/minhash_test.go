@@ -0,0 +1,84 @@
+package minhash
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// sets returns two shingle sets sharing common of total distinct shingles.
+func sets(total, common int) ([][]byte, [][]byte) {
+	var a, b [][]byte
+	for i := 0; i < total; i++ {
+		s := []byte(fmt.Sprintf("shingle-%d", i))
+		switch {
+		case i < common:
+			a, b = append(a, s), append(b, s)
+		case i%2 == 0:
+			a = append(a, s)
+		default:
+			b = append(b, s)
+		}
+	}
+	return a, b
+}
+
+func TestSimilarity(t *testing.T) {
+	hashers := map[string]*Hasher{
+		"k-permutation":   New(256, 1),
+		"one-permutation": NewOnePermutation(256, 1),
+	}
+
+	for name, h := range hashers {
+		for _, j := range []float64{0, 0.2, 0.5, 0.8, 1} {
+			a, b := sets(1000, int(1000*j))
+			est := Similarity(h.Sum(a), h.Sum(b))
+			// Three standard deviations of a binomial over 256 positions.
+			if math.Abs(est-j) > 3*math.Sqrt(j*(1-j)/256)+0.02 {
+				t.Errorf("ERROR: %s: expected similarity about %v but got %v", name, j, est)
+			}
+		}
+	}
+
+	// A set smaller than the number of bins still gives a full signature.
+	h := NewOnePermutation(64, 1)
+	a := h.Sum(ByteShingles([]byte("hello"), 3))
+	for _, v := range a {
+		if v == math.MaxUint64 {
+			t.Fatalf("ERROR: expected densification to fill every bin")
+		}
+	}
+	if Similarity(a, h.Sum(ByteShingles([]byte("hello"), 3))) != 1 {
+		t.Errorf("ERROR: expected identical inputs to have similarity 1")
+	}
+}
+
+func TestShingles(t *testing.T) {
+	if s := ByteShingles([]byte("abcd"), 2); len(s) != 3 || string(s[2]) != "cd" {
+		t.Errorf("ERROR: unexpected byte shingles %q", s)
+	}
+	if s := TokenShingles(strings.Fields("the quick brown fox"), 3); len(s) != 2 || string(s[1]) != "quick brown fox" {
+		t.Errorf("ERROR: unexpected token shingles %q", s)
+	}
+}
+
+func TestLSH(t *testing.T) {
+	h := New(128, 7)
+	index := NewLSH(128, 0.7)
+	if b, r := index.Bands(); b*r > 128 || b < 2 {
+		t.Errorf("ERROR: unexpected band layout %d x %d", b, r)
+	}
+
+	base, _ := sets(400, 400)
+	near, _ := sets(400, 380) // about 0.9 similar to base
+	far, _ := sets(400, 40)
+
+	index.Insert("base", h.Sum(base))
+	index.Insert("far", h.Sum(far))
+
+	got := index.Query(h.Sum(near))
+	if len(got) != 1 || got[0] != "base" {
+		t.Errorf("ERROR: expected [base] as candidates but got %v", got)
+	}
+}
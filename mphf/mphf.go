@@ -0,0 +1,360 @@
+// Package mphf builds minimal perfect hash functions over static key sets
+// with the BBHash algorithm of Limasset et al., "Fast and Scalable Minimal
+// Perfect Hashing for Massive Key Sets".
+//
+// Level i hashes the keys it receives with CityHash64WithSeed(key, i) into a
+// bit array of about gamma bits per key. Keys that land alone set their bit;
+// colliding keys move on to level i+1. A key's index is the number of set
+// bits before its own across all levels, so the n keys map onto [0, n)
+// without storing them. Optional fingerprints of the keys, stored by index,
+// let Lookup reject most keys that are not in the set.
+//
+// An MPHF is a flat blob, produced by Build or MarshalBinary, that Open can
+// query in place, for instance straight from a memory-mapped file.
+package mphf
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zentures/cityhash"
+)
+
+const (
+	// DefaultGamma trades about 3.7 bits per key for fast construction and
+	// lookup; gamma 1 gives about 3 bits per key.
+	DefaultGamma = 2.0
+
+	// maxLevels bounds construction; only duplicate keys should reach it.
+	maxLevels = 64
+
+	// fingerprintSeed makes fingerprints independent of the level hashes.
+	fingerprintSeed = 0xe7037ed1a0b428db
+
+	// A rank sample counts the set bits before every 8 words.
+	rankWords = 8
+)
+
+var (
+	ErrBuildFailed = errors.New("mphf: construction failed, are the keys distinct?")
+	ErrOptions     = errors.New("mphf: invalid options")
+	ErrInvalid     = errors.New("mphf: invalid encoding")
+)
+
+// Options configures Build.
+type Options struct {
+	// Gamma is the number of bits per key of each level, at least 1. Zero
+	// means DefaultGamma.
+	Gamma float64
+
+	// FingerprintBits is 0, 8, 16 or 32. Lookup rejects a key outside the
+	// set with probability 1 - 2^-FingerprintBits.
+	FingerprintBits int
+
+	// Workers is the number of goroutines hashing keys, or
+	// runtime.GOMAXPROCS(0) if zero or less.
+	Workers int
+}
+
+// MPHF is a minimal perfect hash function. It is safe for concurrent use.
+type MPHF struct {
+	n            uint64
+	fpBytes      int
+	sizes        []uint64 // bits of each level, multiples of 64
+	offsets      []uint64 // first bit of each level
+	words        []byte   // the bits of all levels, as little endian uint64s
+	ranks        []byte   // set bits before each group of rankWords words
+	fingerprints []byte   // fpBytes per key, by index
+	blob         []byte
+}
+
+// Len returns the number of keys.
+func (this *MPHF) Len() uint64 {
+	return this.n
+}
+
+func (this *MPHF) word(i uint64) uint64 {
+	return binary.LittleEndian.Uint64(this.words[8*i:])
+}
+
+// rank returns the number of set bits before bit i.
+func (this *MPHF) rank(i uint64) uint64 {
+	w := i / 64
+	r := binary.LittleEndian.Uint64(this.ranks[8*(w/rankWords):])
+	for j := w - w%rankWords; j < w; j++ {
+		r += uint64(bits.OnesCount64(this.word(j)))
+	}
+	return r + uint64(bits.OnesCount64(this.word(w)&(1<<(i%64)-1)))
+}
+
+func position(key []byte, level int, size uint64) uint64 {
+	h := cityhash.CityHash64WithSeed(key, uint32(len(key)), uint64(level))
+	pos, _ := bits.Mul64(h, size)
+	return pos
+}
+
+func fingerprint(key []byte) uint64 {
+	return cityhash.CityHash64WithSeed(key, uint32(len(key)), fingerprintSeed)
+}
+
+// index returns the index of key without checking its fingerprint.
+func (this *MPHF) index(key []byte) (uint64, bool) {
+	for level, size := range this.sizes {
+		bit := this.offsets[level] + position(key, level, size)
+		if this.word(bit/64)&(1<<(bit%64)) != 0 {
+			return this.rank(bit), true
+		}
+	}
+	return 0, false
+}
+
+// Lookup returns the index in [0, Len()) of key. For a key in the set it
+// returns true; for any other key it returns an arbitrary index and true, or
+// false, which with fingerprints is the likely outcome.
+func (this *MPHF) Lookup(key []byte) (uint64, bool) {
+	idx, ok := this.index(key)
+	if !ok || this.fpBytes == 0 {
+		return idx, ok
+	}
+
+	var stored uint64
+	for i := 0; i < this.fpBytes; i++ {
+		stored |= uint64(this.fingerprints[int(idx)*this.fpBytes+i]) << (8 * i)
+	}
+	return idx, stored == fingerprint(key)&(1<<(8*this.fpBytes)-1)
+}
+
+// parallel calls fn on up to workers consecutive chunks of n items.
+func parallel(n, workers int, fn func(worker, lo, hi int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			fn(w, n*w/workers, n*(w+1)/workers)
+		}(w)
+	}
+	wg.Wait()
+}
+
+// setBit sets a bit and reports whether it was already set.
+func setBit(words []uint64, i uint64) bool {
+	word, mask := &words[i/64], uint64(1)<<(i%64)
+	for {
+		old := atomic.LoadUint64(word)
+		if old&mask != 0 {
+			return true
+		}
+		if atomic.CompareAndSwapUint64(word, old, old|mask) {
+			return false
+		}
+	}
+}
+
+// Build returns a minimal perfect hash function of keys, which must be
+// distinct. A nil opts uses the defaults.
+func Build(keys [][]byte, opts *Options) (*MPHF, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Gamma == 0 {
+		o.Gamma = DefaultGamma
+	}
+	if o.Workers <= 0 {
+		o.Workers = runtime.GOMAXPROCS(0)
+	}
+	if !(o.Gamma >= 1) || math.IsInf(o.Gamma, 1) ||
+		(o.FingerprintBits != 0 && o.FingerprintBits != 8 && o.FingerprintBits != 16 && o.FingerprintBits != 32) {
+		return nil, ErrOptions
+	}
+
+	var sizes []uint64
+	var levels [][]uint64
+	remaining := keys
+
+	for len(remaining) > 0 {
+		if len(levels) == maxLevels {
+			return nil, ErrBuildFailed
+		}
+
+		level := len(levels)
+		size := (uint64(math.Ceil(o.Gamma*float64(len(remaining)))) + 63) / 64 * 64
+		seen := make([]uint64, size/64)
+		collided := make([]uint64, size/64)
+
+		parallel(len(remaining), o.Workers, func(_, lo, hi int) {
+			for _, k := range remaining[lo:hi] {
+				if pos := position(k, level, size); setBit(seen, pos) {
+					setBit(collided, pos)
+				}
+			}
+		})
+
+		// Keys alone in their slot keep it; the rest go to the next level.
+		next := make([][][]byte, o.Workers)
+		parallel(len(remaining), o.Workers, func(w, lo, hi int) {
+			for _, k := range remaining[lo:hi] {
+				pos := position(k, level, size)
+				if collided[pos/64]&(1<<(pos%64)) != 0 {
+					next[w] = append(next[w], k)
+				}
+			}
+		})
+		for i := range seen {
+			seen[i] &^= collided[i]
+		}
+
+		sizes = append(sizes, size)
+		levels = append(levels, seen)
+
+		remaining = nil
+		for _, n := range next {
+			remaining = append(remaining, n...)
+		}
+	}
+
+	return assemble(keys, sizes, levels, o)
+}
+
+// The encoding is, little endian throughout and with every section after the
+// header 8-byte aligned:
+//
+//	magic        [4]byte "CHPH"
+//	version      uint8   1
+//	fpBytes      uint8   0, 1, 2 or 4 bytes per fingerprint
+//	             [2]byte reserved, zero
+//	n            uint64  number of keys
+//	levels       uint32
+//	             uint32  reserved, zero
+//	sizes        [levels]uint64 bits of each level, multiples of 64
+//	words        [sum(sizes)/64]uint64 the bits of all levels
+//	ranks        [ceil(len(words)/8)]uint64 set bits before each 8 words
+//	fingerprints [n*fpBytes]byte the low bytes of CityHash64WithSeed(key,
+//	             0xe7037ed1a0b428db), by index
+const headerSize = 24
+
+var magic = [4]byte{'C', 'H', 'P', 'H'}
+
+// assemble encodes the levels and fills in the fingerprints.
+func assemble(keys [][]byte, sizes []uint64, levels [][]uint64, o Options) (*MPHF, error) {
+	var words []uint64
+	for _, l := range levels {
+		words = append(words, l...)
+	}
+	groups := (len(words) + rankWords - 1) / rankWords
+	fpBytes := o.FingerprintBits / 8
+
+	b := make([]byte, 0, headerSize+8*(len(sizes)+len(words)+groups)+len(keys)*fpBytes)
+	b = append(b, magic[:]...)
+	b = append(b, 1, uint8(fpBytes), 0, 0)
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(keys)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(sizes)))
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	for _, size := range sizes {
+		b = binary.LittleEndian.AppendUint64(b, size)
+	}
+	for _, w := range words {
+		b = binary.LittleEndian.AppendUint64(b, w)
+	}
+
+	var r uint64
+	for i, w := range words {
+		if i%rankWords == 0 {
+			b = binary.LittleEndian.AppendUint64(b, r)
+		}
+		r += uint64(bits.OnesCount64(w))
+	}
+	if r != uint64(len(keys)) {
+		return nil, ErrBuildFailed
+	}
+	b = append(b, make([]byte, len(keys)*fpBytes)...)
+
+	this, err := Open(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if fpBytes > 0 {
+		parallel(len(keys), o.Workers, func(_, lo, hi int) {
+			for _, k := range keys[lo:hi] {
+				idx, _ := this.index(k)
+				fp := fingerprint(k)
+				for i := 0; i < fpBytes; i++ {
+					this.fingerprints[int(idx)*fpBytes+i] = uint8(fp >> (8 * i))
+				}
+			}
+		})
+	}
+	return this, nil
+}
+
+func (this *MPHF) MarshalBinary() ([]byte, error) {
+	return append([]byte(nil), this.blob...), nil
+}
+
+// Open returns an MPHF backed by b, an encoding made by MarshalBinary. Nothing
+// is copied, so b must not change while the MPHF is in use.
+func Open(b []byte) (*MPHF, error) {
+	if len(b) < headerSize || [4]byte(b[:4]) != magic || b[4] != 1 {
+		return nil, ErrInvalid
+	}
+
+	this := &MPHF{
+		n:       binary.LittleEndian.Uint64(b[8:]),
+		fpBytes: int(b[5]),
+		blob:    b,
+	}
+	levels := uint64(binary.LittleEndian.Uint32(b[16:]))
+	if this.fpBytes != 0 && this.fpBytes != 1 && this.fpBytes != 2 && this.fpBytes != 4 {
+		return nil, ErrInvalid
+	}
+	if levels > maxLevels || uint64(len(b)-headerSize) < 8*levels {
+		return nil, ErrInvalid
+	}
+
+	var total uint64
+	for i := uint64(0); i < levels; i++ {
+		size := binary.LittleEndian.Uint64(b[headerSize+8*i:])
+		if size == 0 || size%64 != 0 || size > uint64(len(b))*8 {
+			return nil, ErrInvalid
+		}
+		this.sizes = append(this.sizes, size)
+		this.offsets = append(this.offsets, total)
+		total += size
+	}
+
+	words := total / 64
+	groups := (words + rankWords - 1) / rankWords
+	rest := b[headerSize+8*levels:]
+	if this.n > 8*uint64(len(b)) || uint64(len(rest)) != 8*(words+groups)+this.n*uint64(this.fpBytes) {
+		return nil, ErrInvalid
+	}
+
+	this.words = rest[:8*words]
+	this.ranks = rest[8*words : 8*(words+groups)]
+	this.fingerprints = rest[8*(words+groups):]
+	return this, nil
+}
+
+func (this *MPHF) UnmarshalBinary(b []byte) error {
+	m, err := Open(append([]byte(nil), b...))
+	if err != nil {
+		return err
+	}
+
+	*this = *m
+	return nil
+}
@@ -0,0 +1,151 @@
+package mphf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("key-%d", i))
+}
+
+func keys(n int) [][]byte {
+	k := make([][]byte, n)
+	for i := range k {
+		k[i] = key(i)
+	}
+	return k
+}
+
+func TestBuild(t *testing.T) {
+	const n = 100000
+	for _, gamma := range []float64{1, 2, 5} {
+		m, err := Build(keys(n), &Options{Gamma: gamma})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Len() != n {
+			t.Errorf("ERROR: expected %d keys but got %d", n, m.Len())
+		}
+
+		seen := make([]bool, n)
+		for i := 0; i < n; i++ {
+			idx, ok := m.Lookup(key(i))
+			if !ok || idx >= n || seen[idx] {
+				t.Fatalf("ERROR: gamma %v: key %d got index %d (ok %v), not a fresh one", gamma, i, idx, ok)
+			}
+			seen[idx] = true
+		}
+
+		if bitsPerKey := float64(8*len(m.words)) / n; bitsPerKey > 1.6*gamma+1.5 {
+			t.Errorf("ERROR: gamma %v: expected about %v bits per key but got %v", gamma, 1.44*gamma+1, bitsPerKey)
+		}
+	}
+
+	if _, err := Build(append(keys(100), key(7)), nil); err != ErrBuildFailed {
+		t.Errorf("ERROR: expected ErrBuildFailed for duplicate keys but got %v", err)
+	}
+	if _, err := Build(keys(10), &Options{Gamma: 0.5}); err != ErrOptions {
+		t.Errorf("ERROR: expected ErrOptions but got %v", err)
+	}
+	if _, err := Build(keys(10), &Options{FingerprintBits: 12}); err != ErrOptions {
+		t.Errorf("ERROR: expected ErrOptions but got %v", err)
+	}
+
+	empty, err := Build(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := empty.Lookup(key(0)); ok {
+		t.Errorf("ERROR: expected nothing in an empty set")
+	}
+}
+
+func TestParallel(t *testing.T) {
+	one, err := Build(keys(50000), &Options{Workers: 1, FingerprintBits: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	many, err := Build(keys(50000), &Options{Workers: 8, FingerprintBits: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, _ := one.MarshalBinary()
+	b, _ := many.MarshalBinary()
+	if !bytes.Equal(a, b) {
+		t.Errorf("ERROR: expected the same function from 1 and 8 workers")
+	}
+}
+
+func TestFingerprints(t *testing.T) {
+	const n = 20000
+	for _, fpBits := range []int{0, 8, 16, 32} {
+		m, err := Build(keys(n), &Options{FingerprintBits: fpBits})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		accepted := 0
+		for i := n; i < 2*n; i++ {
+			if idx, ok := m.Lookup(key(i)); ok {
+				if idx >= n {
+					t.Fatalf("ERROR: index %d out of range", idx)
+				}
+				accepted++
+			}
+		}
+
+		rate := float64(accepted) / n
+		switch fpBits {
+		case 0:
+			if rate < 0.5 {
+				t.Errorf("ERROR: expected most non-members to get an index without fingerprints but got %v", rate)
+			}
+		case 8:
+			if rate > 2.0/256 {
+				t.Errorf("ERROR: expected about 1/256 of non-members accepted but got %v", rate)
+			}
+		default:
+			if accepted > 2 {
+				t.Errorf("ERROR: expected almost no non-members accepted with %d bits but got %d", fpBits, accepted)
+			}
+		}
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	m, err := Build(keys(10000), &Options{FingerprintBits: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded MPHF
+	if err = decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20000; i++ {
+		idx, ok := m.Lookup(key(i))
+		for _, other := range []*MPHF{opened, &decoded} {
+			if j, o := other.Lookup(key(i)); j != idx || o != ok {
+				t.Fatalf("ERROR: key %d: expected %d, %v but got %d, %v", i, idx, ok, j, o)
+			}
+		}
+	}
+
+	for _, bad := range [][]byte{nil, b[:len(b)-1], append([]byte("XXXX"), b[4:]...)} {
+		if _, err = Open(bad); err != ErrInvalid {
+			t.Errorf("ERROR: expected ErrInvalid but got %v", err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package partition assigns records to partitions by the CityHash64 of their
+// key, in a way producers and consumers in other languages can reproduce.
+//
+// With h the CityHash64 of the key bytes and n the number of partitions, the
+// reductions are
+//
+//	Modulo     h mod n
+//	FastRange  (h * n) >> 64, the high word of the 128-bit product (Lemire)
+//	Jump       the jump consistent hash of h over n buckets (Lamping, Veach)
+//
+// Modulo is what most stream platforms do; FastRange avoids the division;
+// Jump moves only 1/n of the keys when a partition is added.
+package partition
+
+import (
+	"errors"
+	"math/bits"
+	"math/rand"
+	"sync"
+
+	"github.com/zentures/cityhash"
+	"github.com/zentures/cityhash/ring"
+)
+
+// Reduction maps a 64-bit hash onto n partitions.
+type Reduction int
+
+const (
+	Modulo Reduction = iota
+	FastRange
+	Jump
+)
+
+func (this Reduction) String() string {
+	switch this {
+	case Modulo:
+		return "modulo"
+	case FastRange:
+		return "fastrange"
+	case Jump:
+		return "jump"
+	}
+	return "unknown"
+}
+
+var (
+	ErrPartitions = errors.New("partition: number of partitions must be positive")
+	ErrReduction  = errors.New("partition: unknown reduction")
+)
+
+// Partitioner maps keys to partitions. Records with a nil key have nothing to
+// hash and go to a sticky partition instead, which changes after BatchSize of
+// them or on Rotate, so that they fill batches one partition at a time. All
+// methods are safe for concurrent use.
+type Partitioner struct {
+	n         int
+	reduction Reduction
+
+	mu        sync.Mutex
+	batchSize int
+	sticky    int
+	count     int // nil-key records sent to the sticky partition
+}
+
+// New returns a Partitioner over n partitions. The sticky partition only
+// changes on Rotate.
+func New(n int, reduction Reduction) (*Partitioner, error) {
+	if n < 1 {
+		return nil, ErrPartitions
+	}
+	if reduction < Modulo || reduction > Jump {
+		return nil, ErrReduction
+	}
+	return &Partitioner{n: n, reduction: reduction, sticky: rand.Intn(n)}, nil
+}
+
+// Partitions returns the number of partitions.
+func (this *Partitioner) Partitions() int {
+	return this.n
+}
+
+// SetBatchSize makes the sticky partition change after every size records
+// with a nil key. Zero turns that off.
+func (this *Partitioner) SetBatchSize(size int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.batchSize = size
+}
+
+// Partition returns the partition of key. An empty key that is not nil is
+// hashed like any other.
+func (this *Partitioner) Partition(key []byte) int {
+	if key == nil {
+		return this.next()
+	}
+	return this.PartitionHash(cityhash.CityHash64(key, uint32(len(key))))
+}
+
+// PartitionHash returns the partition of a key's CityHash64 value.
+func (this *Partitioner) PartitionHash(h uint64) int {
+	switch this.reduction {
+	case FastRange:
+		hi, _ := bits.Mul64(h, uint64(this.n))
+		return int(hi)
+	case Jump:
+		return ring.JumpHash(h, this.n)
+	}
+	return int(h % uint64(this.n))
+}
+
+func (this *Partitioner) next() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.batchSize > 0 && this.count >= this.batchSize {
+		this.rotate()
+	}
+	this.count++
+	return this.sticky
+}
+
+// Rotate moves the sticky partition to a different one, as when a batch for
+// it has been sent.
+func (this *Partitioner) Rotate() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.rotate()
+}
+
+func (this *Partitioner) rotate() {
+	if this.n > 1 {
+		this.sticky = (this.sticky + 1 + rand.Intn(this.n-1)) % this.n
+	}
+	this.count = 0
+}
@@ -0,0 +1,95 @@
+package partition
+
+import "testing"
+
+// fixtures pin the mapping that other languages must reproduce. Never change
+// an entry: a different value means records move between partitions.
+var fixtures = []struct {
+	key                     string
+	n                       int
+	modulo, fastRange, jump int
+}{
+	{"", 1, 0, 0, 0},
+	{"", 3, 2, 1, 1},
+	{"", 12, 11, 7, 7},
+	{"", 100, 63, 60, 46},
+	{"a", 1, 0, 0, 0},
+	{"a", 3, 0, 2, 0},
+	{"a", 12, 3, 8, 6},
+	{"a", 100, 39, 70, 25},
+	{"user-1", 1, 0, 0, 0},
+	{"user-1", 3, 0, 0, 0},
+	{"user-1", 12, 0, 3, 0},
+	{"user-1", 100, 16, 26, 44},
+	{"user-2", 1, 0, 0, 0},
+	{"user-2", 3, 1, 0, 1},
+	{"user-2", 12, 1, 2, 4},
+	{"user-2", 100, 97, 17, 29},
+	{"order:12345", 1, 0, 0, 0},
+	{"order:12345", 3, 0, 0, 1},
+	{"order:12345", 12, 0, 1, 4},
+	{"order:12345", 100, 76, 10, 94},
+	{"The quick brown fox jumps over the lazy dog", 1, 0, 0, 0},
+	{"The quick brown fox jumps over the lazy dog", 3, 2, 2, 1},
+	{"The quick brown fox jumps over the lazy dog", 12, 5, 9, 3},
+	{"The quick brown fox jumps over the lazy dog", 100, 1, 75, 98},
+}
+
+func TestFixtures(t *testing.T) {
+	for _, f := range fixtures {
+		for r, expected := range map[Reduction]int{Modulo: f.modulo, FastRange: f.fastRange, Jump: f.jump} {
+			p, err := New(f.n, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := p.Partition([]byte(f.key)); actual != expected {
+				t.Errorf("ERROR: %q over %d with %v: expected %d but got %d", f.key, f.n, r, expected, actual)
+			}
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(0, Modulo); err != ErrPartitions {
+		t.Errorf("ERROR: expected ErrPartitions but got %v", err)
+	}
+	if _, err := New(4, Reduction(7)); err != ErrReduction {
+		t.Errorf("ERROR: expected ErrReduction but got %v", err)
+	}
+}
+
+func TestSticky(t *testing.T) {
+	p, _ := New(8, Modulo)
+
+	first := p.Partition(nil)
+	for i := 0; i < 100; i++ {
+		if actual := p.Partition(nil); actual != first {
+			t.Fatalf("ERROR: expected nil keys to stick to %d but got %d", first, actual)
+		}
+	}
+
+	p.Rotate()
+	if actual := p.Partition(nil); actual == first {
+		t.Errorf("ERROR: expected Rotate to move away from %d", first)
+	}
+
+	p.SetBatchSize(10)
+	p.Rotate()
+	changes, last := 0, p.Partition(nil)
+	for i := 1; i < 100; i++ {
+		if actual := p.Partition(nil); actual != last {
+			if i%10 != 0 {
+				t.Errorf("ERROR: expected the sticky partition to change every 10 records but it changed at %d", i)
+			}
+			changes, last = changes+1, actual
+		}
+	}
+	if changes != 9 {
+		t.Errorf("ERROR: expected 9 changes but got %d", changes)
+	}
+
+	// An empty key is a key, not a nil one.
+	if p.Partition([]byte{}) != p.PartitionHash(0x9ae16a3b2f90404f) {
+		t.Errorf("ERROR: expected the empty key to be hashed")
+	}
+}
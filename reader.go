@@ -0,0 +1,275 @@
+package cityhash
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+const defaultReaderBlockSize = 1 << 20
+
+// HashReaderOptions configures HashReader128Context. A nil *HashReaderOptions
+// selects the defaults.
+type HashReaderOptions struct {
+	// BlockSize is the number of bytes read and hashed between checks of
+	// ctx.Done(). It is rounded up to a multiple of 128 and defaults to 1 MiB.
+	BlockSize int
+
+	// Size is the total input length, if the caller knows it. CityHash128
+	// mixes the length into its initial state, so when Size is not positive
+	// and r can tell neither its length (Len() int) nor be seeked to its end,
+	// the whole input is buffered before hashing starts.
+	Size int64
+
+	// Progress, if not nil, is called after every block with the total
+	// number of bytes consumed from r so far.
+	Progress func(n int64)
+}
+
+// HashReader128Context returns CityHash128 of everything read from r. It
+// checks ctx between blocks and returns ctx.Err() as soon as it is done.
+// For inputs that fit in a uint32 the result equals CityHash128 of the same
+// bytes; longer inputs are hashed with the full 64-bit length, as the
+// reference C++ implementation does.
+func HashReader128Context(ctx context.Context, r io.Reader, opts *HashReaderOptions) (Uint128, error) {
+	var o HashReaderOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.BlockSize <= 0 {
+		o.BlockSize = defaultReaderBlockSize
+	}
+	o.BlockSize = (o.BlockSize + 127) &^ 127
+
+	hr := &hashReader{ctx: ctx, r: r, progress: o.Progress}
+
+	size := o.Size
+	if size <= 0 {
+		var ok bool
+		if size, ok = readerLen(r); !ok {
+			buf, err := hr.readAll(o.BlockSize)
+			if err != nil {
+				return Uint128{}, err
+			}
+			// Progress has been reported while buffering; hashing the buffer
+			// still honours ctx but consumes nothing more from r.
+			hr.r, hr.progress = bytes.NewReader(buf), nil
+			size = int64(len(buf))
+		}
+	}
+
+	return hr.hash128(uint64(size), o.BlockSize)
+}
+
+// readerLen reports how many bytes are left in r, if r can tell.
+func readerLen(r io.Reader) (int64, bool) {
+	if l, ok := r.(interface{ Len() int }); ok {
+		return int64(l.Len()), true
+	}
+
+	if s, ok := r.(io.Seeker); ok {
+		cur, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, false
+		}
+		if _, err = s.Seek(cur, io.SeekStart); err != nil {
+			return 0, false
+		}
+		return end - cur, true
+	}
+
+	return 0, false
+}
+
+type hashReader struct {
+	ctx      context.Context
+	r        io.Reader
+	n        int64
+	progress func(n int64)
+}
+
+func (this *hashReader) done() error {
+	select {
+	case <-this.ctx.Done():
+		return this.ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// read fills p from r. Running out of input early is io.ErrUnexpectedEOF,
+// since the length has already been mixed into the hash.
+func (this *hashReader) read(p []byte) error {
+	if err := this.done(); err != nil {
+		return err
+	}
+
+	n, err := io.ReadFull(this.r, p)
+	this.n += int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+
+	if this.progress != nil {
+		this.progress(this.n)
+	}
+	return nil
+}
+
+func (this *hashReader) readAll(blockSize int) ([]byte, error) {
+	var buf []byte
+	for {
+		if err := this.done(); err != nil {
+			return nil, err
+		}
+
+		if cap(buf)-len(buf) < blockSize {
+			buf = append(buf, make([]byte, blockSize)...)[:len(buf)]
+		}
+
+		n, err := io.ReadAtLeast(this.r, buf[len(buf):len(buf)+blockSize], 1)
+		buf = buf[:len(buf)+n]
+		this.n += int64(n)
+		if n > 0 && this.progress != nil {
+			this.progress(this.n)
+		}
+
+		if err == io.EOF {
+			return buf, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (this *hashReader) hash128(size uint64, blockSize int) (Uint128, error) {
+	// Short inputs never reach the 128-byte loop; hash them in one go.
+	if size < 16+128 {
+		buf := make([]byte, size)
+		if err := this.read(buf); err != nil {
+			return Uint128{}, err
+		}
+		return CityHash128(buf, uint32(size)), nil
+	}
+
+	var prefix [16]byte
+	if err := this.read(prefix[:]); err != nil {
+		return Uint128{}, err
+	}
+
+	var seed Uint128 = Uint128{fetch64(prefix[:]), fetch64(prefix[8:]) + k0}
+	var length uint64 = size - 16
+	var chunks uint64 = length / 128
+	var rem uint64 = length % 128
+
+	var st city128State
+	var buf []byte = make([]byte, blockSize)
+	var tail [256]byte
+
+	for done := uint64(0); done < chunks; {
+		var m uint64 = chunks - done
+		if limit := uint64(blockSize / 128); m > limit {
+			m = limit
+		}
+
+		b := buf[:m*128]
+		if err := this.read(b); err != nil {
+			return Uint128{}, err
+		}
+
+		if done == 0 {
+			st.init(b, length, seed)
+		}
+		for ; len(b) > 0; b = b[128:] {
+			st.round(b)
+		}
+
+		copy(tail[:128], buf[m*128-128:m*128])
+		done += m
+	}
+
+	if rem > 0 {
+		if err := this.read(tail[128 : 128+rem]); err != nil {
+			return Uint128{}, err
+		}
+	}
+
+	return st.finish(tail[rem:128+rem], rem), nil
+}
+
+// city128State is the 56 bytes of state CityHash128WithSeed keeps while it
+// walks inputs of 128 bytes or more, split out so the input can arrive in
+// pieces.
+type city128State struct {
+	v, w    Uint128
+	x, y, z uint64
+}
+
+// init sets up the state from the first 128 bytes of s and the total length.
+func (this *city128State) init(s []byte, length uint64, seed Uint128) {
+	this.x = seed.Lower64()
+	this.y = seed.Higher64()
+	this.z = length * k1
+
+	this.v.setLower64(rotate64(this.y^k1, 49)*k1 + fetch64(s))
+	this.v.setHigher64(rotate64(this.v.Lower64(), 42)*k1 + fetch64(s[8:]))
+	this.w.setLower64(rotate64(this.y+this.z, 35)*k1 + this.x)
+	this.w.setHigher64(rotate64(this.x+fetch64(s[88:]), 53) * k1)
+}
+
+// round consumes the next 128 bytes of s.
+func (this *city128State) round(s []byte) {
+	this.half(s)
+	this.half(s[64:])
+}
+
+func (this *city128State) half(s []byte) {
+	x, y, z, v, w := this.x, this.y, this.z, this.v, this.w
+
+	x = rotate64(x+y+v.Lower64()+fetch64(s[8:]), 37) * k1
+	y = rotate64(y+v.Higher64()+fetch64(s[48:]), 42) * k1
+	x ^= w.Higher64()
+	y += v.Lower64() + fetch64(s[40:])
+	z = rotate64(z+w.Lower64(), 33) * k1
+	v = weakHashLen32WithSeeds_3(s, v.Higher64()*k1, x+w.Lower64())
+	w = weakHashLen32WithSeeds_3(s[32:], z+w.Higher64(), y+fetch64(s[16:]))
+	swap64(&z, &x)
+
+	this.x, this.y, this.z, this.v, this.w = x, y, z, v, w
+}
+
+// finish mixes in the rem (< 128) bytes left after the last round. last holds
+// the final 128 bytes of the input, which the tail loop reads backwards.
+func (this *city128State) finish(last []byte, rem uint64) Uint128 {
+	x, y, z, v, w := this.x, this.y, this.z, this.v, this.w
+
+	x += rotate64(v.Lower64()+z, 49) * k0
+	y = y*k0 + rotate64(w.Higher64(), 37)
+	z = z*k0 + rotate64(w.Lower64(), 27)
+	w.setLower64(w.Lower64() * 9)
+	v.setLower64(v.Lower64() * k0)
+
+	for tail_done := uint64(0); tail_done < rem; {
+		tail_done += 32
+		y = rotate64(x+y, 42)*k0 + v.Higher64()
+		w.setLower64(w.Lower64() + fetch64(last[128-tail_done+16:]))
+		x = x*k0 + w.Lower64()
+		z += w.Higher64() + fetch64(last[128-tail_done:])
+		w.setHigher64(w.Higher64() + v.Lower64())
+		v = weakHashLen32WithSeeds_3(last[128-tail_done:], v.Lower64()+z, v.Higher64())
+		v.setLower64(v.Lower64() * k0)
+	}
+
+	x = hashLen16(x, v.Lower64())
+	y = hashLen16(y+z, w.Lower64())
+
+	return Uint128{hashLen16(x+v.Higher64(), w.Higher64()) + y,
+		hashLen16(x+w.Higher64(), y+v.Higher64())}
+}
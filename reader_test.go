@@ -0,0 +1,84 @@
+package cityhash
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestHashReader128Context(t *testing.T) {
+	setup()
+
+	lengths := []int{0, 1, 15, 16, 17, 143, 144, 145, 160, 271, 272, 300, 1000, 4097, kDataSize}
+	for _, length := range lengths {
+		expected := CityHash128(data[:], uint32(length))
+
+		for _, bs := range []int{0, 1, 128, 1000} {
+			opts := &HashReaderOptions{BlockSize: bs}
+
+			// bytes.Reader reports its length.
+			u, err := HashReader128Context(context.Background(), bytes.NewReader(data[:length]), opts)
+			if err != nil {
+				t.Fatalf("length %d, block size %d: %v", length, bs, err)
+			}
+			check(expected.Lower64(), u.Lower64(), t)
+			check(expected.Higher64(), u.Higher64(), t)
+
+			// io.MultiReader hides it, so the input gets buffered.
+			u, err = HashReader128Context(context.Background(), io.MultiReader(bytes.NewReader(data[:length])), opts)
+			if err != nil {
+				t.Fatalf("length %d, block size %d: %v", length, bs, err)
+			}
+			check(expected.Lower64(), u.Lower64(), t)
+			check(expected.Higher64(), u.Higher64(), t)
+		}
+	}
+}
+
+func TestHashReader128ContextProgress(t *testing.T) {
+	setup()
+
+	var last int64
+	opts := &HashReaderOptions{
+		BlockSize: 4096,
+		Size:      int64(kDataSize),
+		Progress: func(n int64) {
+			if n < last {
+				t.Errorf("ERROR: progress went backwards from %d to %d", last, n)
+			}
+			last = n
+		},
+	}
+
+	if _, err := HashReader128Context(context.Background(), io.MultiReader(bytes.NewReader(data[:])), opts); err != nil {
+		t.Fatal(err)
+	}
+	if last != int64(kDataSize) {
+		t.Errorf("ERROR: expected progress to end at %d but got %d", kDataSize, last)
+	}
+
+	opts.Size++
+	last = 0
+	if _, err := HashReader128Context(context.Background(), bytes.NewReader(data[:]), opts); err != io.ErrUnexpectedEOF {
+		t.Errorf("ERROR: expected io.ErrUnexpectedEOF for a short input but got %v", err)
+	}
+}
+
+func TestHashReader128ContextCancel(t *testing.T) {
+	setup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := &HashReaderOptions{
+		BlockSize: 4096,
+		Progress: func(n int64) {
+			if n >= 1<<16 {
+				cancel()
+			}
+		},
+	}
+
+	if _, err := HashReader128Context(ctx, bytes.NewReader(data[:]), opts); err != context.Canceled {
+		t.Errorf("ERROR: expected context.Canceled but got %v", err)
+	}
+}
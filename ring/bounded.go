@@ -0,0 +1,101 @@
+package ring
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/zentures/cityhash"
+)
+
+var ErrLoadFactor = errors.New("ring: load factor must be greater than 1")
+
+// Bounded assigns keys with consistent hashing with bounded loads (Mirrokni,
+// Thorup and Zadimoghaddam). With m keys assigned, no node takes more than
+// ceil(c * (m+1) * weight/total weight) of them, where c is the load factor;
+// a key whose owner on the ring is full goes to the next node clockwise that
+// is not. The walk is deterministic, so equal loads give equal assignments.
+// All methods are safe for concurrent use.
+type Bounded struct {
+	ring   *Ring
+	factor float64
+
+	mu    sync.Mutex
+	loads map[string]int
+	total int
+}
+
+// NewBounded returns a Bounded that places keys on ring with load factor c,
+// typically 1.25. Membership changes go through the ring.
+func NewBounded(ring *Ring, c float64) (*Bounded, error) {
+	if !(c > 1) || math.IsInf(c, 1) {
+		return nil, ErrLoadFactor
+	}
+	return &Bounded{ring: ring, factor: c, loads: make(map[string]int)}, nil
+}
+
+// Acquire assigns key to a node that is below its bound and counts the key
+// against it, or returns false if the ring is empty. Each Acquire must be
+// paired with a Release of the returned node.
+func (this *Bounded) Acquire(key []byte) (string, bool) {
+	h := cityhash.CityHash64(key, uint32(len(key)))
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	s := this.ring.state.Load()
+	if len(s.points) == 0 {
+		return "", false
+	}
+
+	// The bounds add up to more than the load, so some node is below its own.
+	start := s.search(h)
+	for i := 0; i < len(s.points); i++ {
+		name := s.points[(start+i)%len(s.points)].node
+		if this.loads[name] < this.bound(s, name) {
+			this.loads[name]++
+			this.total++
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// bound returns the most keys the named node may take with one more key.
+func (this *Bounded) bound(s *state, name string) int {
+	return int(math.Ceil(this.factor * float64(this.total+1) * s.nodes[name].Weight / s.weight))
+}
+
+// Release returns a key that Acquire assigned to node.
+func (this *Bounded) Release(node string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.loads[node] > 0 {
+		this.loads[node]--
+		this.total--
+		if this.loads[node] == 0 {
+			delete(this.loads, node)
+		}
+	}
+}
+
+// Load returns the number of keys assigned to node.
+func (this *Bounded) Load(node string) int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.loads[node]
+}
+
+// Loads returns the number of keys assigned to each node that has any.
+func (this *Bounded) Loads() map[string]int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	loads := make(map[string]int, len(this.loads))
+	for n, l := range this.loads {
+		loads[n] = l
+	}
+	return loads
+}
@@ -0,0 +1,98 @@
+package ring
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestBounded(t *testing.T) {
+	r := New()
+	if _, err := NewBounded(r, 1); err != ErrLoadFactor {
+		t.Errorf("ERROR: expected ErrLoadFactor but got %v", err)
+	}
+
+	b, err := NewBounded(r, 1.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Acquire(key(0)); ok {
+		t.Errorf("ERROR: expected no node from an empty ring")
+	}
+
+	for _, n := range nodes(8) {
+		r.Add(n)
+	}
+
+	// Every key is the same hot key, yet no node goes over its bound.
+	const n = 8000
+	for i := 0; i < n; i++ {
+		b.Acquire([]byte("hot"))
+	}
+	for name, load := range b.Loads() {
+		if bound := int(math.Ceil(1.25 * n / 8)); load > bound {
+			t.Errorf("ERROR: expected %s to have at most %d keys but got %d", name, bound, load)
+		}
+	}
+
+	// Assignments are deterministic given the same history.
+	other, _ := NewBounded(r, 1.25)
+	for i := 0; i < n; i++ {
+		other.Acquire([]byte("hot"))
+	}
+	if fmt.Sprint(other.Loads()) != fmt.Sprint(b.Loads()) {
+		t.Errorf("ERROR: expected equal loads but got %v and %v", other.Loads(), b.Loads())
+	}
+
+	// With spare capacity a key goes to its owner on the ring.
+	for name, load := range b.Loads() {
+		for i := 0; i < load; i++ {
+			b.Release(name)
+		}
+	}
+	owner, _ := r.Get(key(1))
+	if node, _ := b.Acquire(key(1)); node != owner || b.Load(owner) != 1 {
+		t.Errorf("ERROR: expected %s but got %s", owner, node)
+	}
+	b.Release(owner)
+	if len(b.Loads()) != 0 {
+		t.Errorf("ERROR: expected no load after releasing everything but got %v", b.Loads())
+	}
+}
+
+func TestBoundedConcurrent(t *testing.T) {
+	r := New()
+	for _, n := range nodes(4) {
+		r.Add(n)
+	}
+	b, _ := NewBounded(r, 1.5)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				node, ok := b.Acquire(key(g*1000 + i))
+				if !ok {
+					t.Errorf("ERROR: expected a node")
+					return
+				}
+				if i%2 == 0 {
+					b.Release(node)
+				}
+			}
+		}(g)
+	}
+	r.Add(Node{"late", 1})
+	wg.Wait()
+
+	total := 0
+	for _, l := range b.Loads() {
+		total += l
+	}
+	if total != 4000 {
+		t.Errorf("ERROR: expected 4000 assigned keys but got %d", total)
+	}
+}
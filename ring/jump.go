@@ -0,0 +1,38 @@
+package ring
+
+import "github.com/zentures/cityhash"
+
+// JumpHash maps key to a bucket in [0, buckets) with the jump consistent hash
+// of Lamping and Veach, "A Fast, Minimal Memory, Consistent Hash Algorithm".
+// Growing from n to n+1 buckets moves only 1/(n+1) of the keys, all to the
+// new bucket. Buckets can only be added or removed at the end.
+func JumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// Jump is JumpHash of the key's CityHash64.
+func Jump(key []byte, buckets int) int {
+	return JumpHash(cityhash.CityHash64(key, uint32(len(key))), buckets)
+}
+
+// Disruption returns the fraction of keys that before and after assign to
+// different backends, for measuring the effect of a membership change.
+func Disruption(keys [][]byte, before, after func(key []byte) string) float64 {
+	if len(keys) == 0 {
+		return 0
+	}
+
+	moved := 0
+	for _, k := range keys {
+		if before(k) != after(k) {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(keys))
+}
@@ -0,0 +1,100 @@
+package ring
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func keys(n int) [][]byte {
+	k := make([][]byte, n)
+	for i := range k {
+		k[i] = key(i)
+	}
+	return k
+}
+
+func TestJump(t *testing.T) {
+	const n = 20000
+	for buckets := 1; buckets < 20; buckets++ {
+		counts := make([]int, buckets+1)
+		for i := 0; i < n; i++ {
+			b := Jump(key(i), buckets)
+			if b < 0 || b >= buckets {
+				t.Fatalf("ERROR: expected a bucket in [0, %d) but got %d", buckets, b)
+			}
+			// Growing by one bucket only moves keys to the new one.
+			if c := Jump(key(i), buckets+1); c != b && c != buckets {
+				t.Fatalf("ERROR: key %d moved from %d to %d, not the new bucket %d", i, b, c, buckets)
+			}
+			counts[b]++
+		}
+
+		for b, c := range counts[:buckets] {
+			if expected := float64(n) / float64(buckets); math.Abs(float64(c)-expected) > expected*0.1 {
+				t.Errorf("ERROR: expected about %v keys in bucket %d of %d but got %d", expected, b, buckets, c)
+			}
+		}
+	}
+
+	d := Disruption(keys(n),
+		func(k []byte) string { return fmt.Sprint(Jump(k, 9)) },
+		func(k []byte) string { return fmt.Sprint(Jump(k, 10)) })
+	if math.Abs(d-0.1) > 0.01 {
+		t.Errorf("ERROR: expected about 10%% of keys to move but got %v", d)
+	}
+}
+
+func TestMaglev(t *testing.T) {
+	var backends []string
+	for i := 0; i < 10; i++ {
+		backends = append(backends, fmt.Sprintf("backend-%d", i))
+	}
+
+	if _, err := NewMaglevWithSize(backends, 100); err != ErrTableSize {
+		t.Errorf("ERROR: expected ErrTableSize for a composite size but got %v", err)
+	}
+	if _, err := NewMaglevWithSize(backends, 7); err != ErrTableSize {
+		t.Errorf("ERROR: expected ErrTableSize for a small table but got %v", err)
+	}
+	if _, err := NewMaglev(nil); err != ErrNoBackends {
+		t.Errorf("ERROR: expected ErrNoBackends but got %v", err)
+	}
+
+	m, err := NewMaglev(backends)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	for _, b := range m.table {
+		counts[m.backends[b]]++
+	}
+	for _, b := range backends {
+		if expected := float64(m.Size()) / 10; math.Abs(float64(counts[b])-expected) > expected*0.02 {
+			t.Errorf("ERROR: expected about %v entries for %s but got %d", expected, b, counts[b])
+		}
+	}
+
+	// Removing one of ten backends moves its tenth and little else.
+	smaller, err := NewMaglev(backends[:9])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := TableDisruption(m, smaller)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d < 0.1 || d > 0.15 {
+		t.Errorf("ERROR: expected a little over 10%% of entries to move but got %v", d)
+	}
+
+	if k := Disruption(keys(20000), m.Get, smaller.Get); math.Abs(k-d) > 0.02 {
+		t.Errorf("ERROR: expected key disruption %v to match table disruption %v", k, d)
+	}
+
+	other, _ := NewMaglevWithSize(backends, 251)
+	if _, err = TableDisruption(m, other); err != ErrIncompatible {
+		t.Errorf("ERROR: expected ErrIncompatible but got %v", err)
+	}
+}
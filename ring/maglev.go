@@ -0,0 +1,124 @@
+package ring
+
+import (
+	"errors"
+
+	"github.com/zentures/cityhash"
+)
+
+// DefaultMaglevSize is the lookup table size used by NewMaglev. It is prime
+// and, as the paper recommends, far larger than the number of backends.
+const DefaultMaglevSize = 65537
+
+// The seeds of the offset and skip hashes of a backend name.
+const (
+	maglevOffsetSeed = 0xc3a5c85c97cb3127
+	maglevSkipSeed   = 0xb492b66fbe98f273
+)
+
+var (
+	ErrTableSize    = errors.New("ring: Maglev table size must be a prime larger than the number of backends")
+	ErrNoBackends   = errors.New("ring: no backends")
+	ErrIncompatible = errors.New("ring: tables have different sizes")
+)
+
+// Maglev is a lookup table built as in Eisenbud et al., "Maglev: A Fast and
+// Reliable Software Network Load Balancer". Each backend fills the table in
+// its own permutation, with offset and skip from CityHash64WithSeed of its
+// name, so every backend owns an almost equal share of the entries and a
+// change of backends moves few of them. A Maglev is immutable and safe for
+// concurrent use.
+type Maglev struct {
+	backends []string
+	table    []int32 // index into backends
+}
+
+// NewMaglev builds a table of DefaultMaglevSize entries for backends.
+func NewMaglev(backends []string) (*Maglev, error) {
+	return NewMaglevWithSize(backends, DefaultMaglevSize)
+}
+
+// NewMaglevWithSize builds a table of size entries for backends. Size must be
+// a prime larger than the number of backends.
+func NewMaglevWithSize(backends []string, size int) (*Maglev, error) {
+	if len(backends) == 0 {
+		return nil, ErrNoBackends
+	}
+	if size <= len(backends) || !prime(size) {
+		return nil, ErrTableSize
+	}
+
+	m := uint64(size)
+	offsets := make([]uint64, len(backends))
+	skips := make([]uint64, len(backends))
+	for i, b := range backends {
+		offsets[i] = cityhash.CityHash64WithSeed([]byte(b), uint32(len(b)), maglevOffsetSeed) % m
+		skips[i] = cityhash.CityHash64WithSeed([]byte(b), uint32(len(b)), maglevSkipSeed)%(m-1) + 1
+	}
+
+	table := make([]int32, size)
+	for i := range table {
+		table[i] = -1
+	}
+	next := make([]uint64, len(backends))
+
+	for filled := 0; ; {
+		for i := range backends {
+			c := (offsets[i] + next[i]*skips[i]) % m
+			for table[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % m
+			}
+			table[c] = int32(i)
+			next[i]++
+
+			if filled++; filled == size {
+				return &Maglev{backends: append([]string(nil), backends...), table: table}, nil
+			}
+		}
+	}
+}
+
+func prime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Size returns the number of table entries.
+func (this *Maglev) Size() int {
+	return len(this.table)
+}
+
+// Get returns the backend for key, looked up by its CityHash64.
+func (this *Maglev) Get(key []byte) string {
+	return this.GetHash(cityhash.CityHash64(key, uint32(len(key))))
+}
+
+// GetHash is like Get for a key's CityHash64 value.
+func (this *Maglev) GetHash(h uint64) string {
+	return this.backends[this.table[h%uint64(len(this.table))]]
+}
+
+// TableDisruption returns the fraction of table entries whose backend differs
+// between two tables of the same size, which is the fraction of keys that
+// move between them.
+func TableDisruption(before, after *Maglev) (float64, error) {
+	if len(before.table) != len(after.table) {
+		return 0, ErrIncompatible
+	}
+
+	moved := 0
+	for i := range before.table {
+		if before.backends[before.table[i]] != after.backends[after.table[i]] {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(before.table)), nil
+}
@@ -0,0 +1,195 @@
+package ring
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/zentures/cityhash"
+)
+
+// Rendezvous picks nodes by highest random weight (Thaler and Ravishankar).
+// A node's score for a key is -weight/ln(u), where u in (0, 1) comes from
+// CityHash64WithSeeds of the key with the two halves of CityHash128 of the
+// node's name as seeds; the highest score wins. Each node wins a share of the
+// keys proportional to its weight, and removing a node only moves its own
+// keys. A Rendezvous is immutable and safe for concurrent use.
+type Rendezvous struct {
+	nodes []hrwNode
+}
+
+type hrwNode struct {
+	name   string
+	seeds  cityhash.Uint128
+	weight float64
+}
+
+func newHRWNode(name string, weight float64) hrwNode {
+	return hrwNode{name, cityhash.CityHash128([]byte(name), uint32(len(name))), weight}
+}
+
+func (this *hrwNode) score(key []byte) float64 {
+	h := cityhash.CityHash64WithSeeds(key, uint32(len(key)), this.seeds.Lower64(), this.seeds.Higher64())
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return -this.weight / math.Log(u)
+}
+
+func checkNodes(nodes []Node) error {
+	seen := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		if !(n.Weight > 0) || math.IsInf(n.Weight, 1) {
+			return ErrWeight
+		}
+		if seen[n.Name] {
+			return ErrExists
+		}
+		seen[n.Name] = true
+	}
+	return nil
+}
+
+// NewRendezvous returns a Rendezvous over nodes, which must have distinct
+// names and positive weights.
+func NewRendezvous(nodes []Node) (*Rendezvous, error) {
+	if err := checkNodes(nodes); err != nil {
+		return nil, err
+	}
+
+	this := &Rendezvous{}
+	for _, n := range nodes {
+		this.nodes = append(this.nodes, newHRWNode(n.Name, n.Weight))
+	}
+	return this, nil
+}
+
+// Get returns the node with the highest score for key, or false if there are
+// no nodes. It costs one hash per node.
+func (this *Rendezvous) Get(key []byte) (string, bool) {
+	best, name := math.Inf(-1), ""
+	for i := range this.nodes {
+		if s := this.nodes[i].score(key); s > best || (s == best && this.nodes[i].name < name) {
+			best, name = s, this.nodes[i].name
+		}
+	}
+	return name, len(this.nodes) > 0
+}
+
+// GetN returns the n nodes with the highest scores for key, best first, for
+// placing replicas.
+func (this *Rendezvous) GetN(key []byte, n int) []string {
+	type scored struct {
+		name  string
+		score float64
+	}
+
+	all := make([]scored, len(this.nodes))
+	for i := range this.nodes {
+		all[i] = scored{this.nodes[i].name, this.nodes[i].score(key)}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].score > all[j].score || (all[i].score == all[j].score && all[i].name < all[j].name)
+	})
+
+	if n > len(all) {
+		n = len(all)
+	}
+	if n < 1 {
+		return nil
+	}
+
+	names := make([]string, n)
+	for i := range names {
+		names[i] = all[i].name
+	}
+	return names
+}
+
+// Skeleton is rendezvous hashing over a fixed virtual hierarchy, after Wang
+// and Ravishankar, "Memory-Efficient and Skew-Tolerant Rendezvous Hashing".
+// Nodes hang off the leaves of a complete tree of the given fanout and depth,
+// at the path spelled by the digits of their name's CityHash64; each level
+// picks a child by weighted rendezvous hashing with the total weight below
+// it. A lookup costs about fanout*depth + n/fanout^depth hashes instead of n.
+// Since the tree does not depend on the nodes, adding or removing a node only
+// moves keys into or out of the subtrees on its path. A Skeleton is immutable
+// and safe for concurrent use.
+type Skeleton struct {
+	root *skeletonNode
+}
+
+type skeletonNode struct {
+	hrwNode
+	digit    uint64          // position among its siblings
+	children []*skeletonNode // nil for a node
+}
+
+// skeletonSeed places node names in the tree.
+const skeletonSeed = 0x9ae16a3b2f90404f
+
+// NewSkeleton returns a Skeleton over nodes, which must have distinct names
+// and positive weights. Choose fanout^(depth+1) near the number of nodes.
+func NewSkeleton(nodes []Node, fanout, depth int) (*Skeleton, error) {
+	if err := checkNodes(nodes); err != nil {
+		return nil, err
+	}
+	if fanout < 2 {
+		fanout = 2
+	}
+	if depth < 0 {
+		depth = 0
+	}
+
+	root := &skeletonNode{hrwNode: virtualNode(nil)}
+	for _, n := range nodes {
+		h := cityhash.CityHash64WithSeed([]byte(n.Name), uint32(len(n.Name)), skeletonSeed)
+
+		v, path := root, []uint64(nil)
+		v.weight += n.Weight
+		for level := 0; level < depth; level++ {
+			digit := h % uint64(fanout)
+			h /= uint64(fanout)
+			path = append(path, digit)
+
+			var child *skeletonNode
+			for _, c := range v.children {
+				if c.digit == digit {
+					child = c
+				}
+			}
+			if child == nil {
+				child = &skeletonNode{hrwNode: virtualNode(path)}
+				child.digit = digit
+				v.children = append(v.children, child)
+			}
+			child.weight += n.Weight
+			v = child
+		}
+		v.children = append(v.children, &skeletonNode{hrwNode: newHRWNode(n.Name, n.Weight)})
+	}
+	return &Skeleton{root: root}, nil
+}
+
+// virtualNode returns an inner node whose seeds come from its path.
+func virtualNode(path []uint64) hrwNode {
+	b := []byte("skeleton")
+	for _, d := range path {
+		b = binary.LittleEndian.AppendUint64(b, d)
+	}
+	return hrwNode{seeds: cityhash.CityHash128(b, uint32(len(b)))}
+}
+
+// Get returns the node for key, or false if there are no nodes.
+func (this *Skeleton) Get(key []byte) (string, bool) {
+	v := this.root
+	for v.children != nil {
+		var best *skeletonNode
+		bestScore := math.Inf(-1)
+		for _, c := range v.children {
+			if s := c.score(key); s > bestScore {
+				best, bestScore = c, s
+			}
+		}
+		v = best
+	}
+	return v.name, v != this.root
+}
@@ -0,0 +1,102 @@
+package ring
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func nodes(n int) []Node {
+	var nodes []Node
+	for i := 0; i < n; i++ {
+		nodes = append(nodes, Node{fmt.Sprintf("node-%d", i), 1})
+	}
+	return nodes
+}
+
+func TestRendezvous(t *testing.T) {
+	if _, err := NewRendezvous([]Node{{"a", 1}, {"a", 2}}); err != ErrExists {
+		t.Errorf("ERROR: expected ErrExists but got %v", err)
+	}
+	if _, err := NewRendezvous([]Node{{"a", -1}}); err != ErrWeight {
+		t.Errorf("ERROR: expected ErrWeight but got %v", err)
+	}
+
+	empty, _ := NewRendezvous(nil)
+	if _, ok := empty.Get(key(0)); ok {
+		t.Errorf("ERROR: expected no node from an empty set")
+	}
+
+	r, err := NewRendezvous([]Node{{"a", 1}, {"b", 1}, {"c", 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 100000
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		name, _ := r.Get(key(i))
+		counts[name]++
+
+		top := r.GetN(key(i), 3)
+		if len(top) != 3 || top[0] != name || top[1] == top[2] {
+			t.Fatalf("ERROR: expected 3 distinct nodes starting with %s but got %v", name, top)
+		}
+	}
+	for name, expected := range map[string]float64{"a": 0.25, "b": 0.25, "c": 0.5} {
+		if share := float64(counts[name]) / n; math.Abs(share-expected) > 0.01 {
+			t.Errorf("ERROR: expected %s to win about %v of the keys but got %v", name, expected, share)
+		}
+	}
+
+	// Removing a node only moves its own keys.
+	smaller, _ := NewRendezvous([]Node{{"a", 1}, {"c", 2}})
+	for i := 0; i < 10000; i++ {
+		before, _ := r.Get(key(i))
+		after, _ := smaller.Get(key(i))
+		if before != "b" && before != after {
+			t.Fatalf("ERROR: key %d moved from %s to %s", i, before, after)
+		}
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	all := nodes(200)
+	s, err := NewSkeleton(all, 4, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 200000
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		name, ok := s.Get(key(i))
+		if !ok {
+			t.Fatalf("ERROR: expected a node for key %d", i)
+		}
+		counts[name]++
+	}
+	if len(counts) != len(all) {
+		t.Errorf("ERROR: expected all %d nodes to get keys but got %d", len(all), len(counts))
+	}
+	for _, node := range all {
+		if c := counts[node.Name]; c < n/len(all)/2 || c > 2*n/len(all) {
+			t.Errorf("ERROR: expected about %d keys for %s but got %d", n/len(all), node.Name, c)
+		}
+	}
+
+	// Adding a node moves about its share of the keys, plus some shuffling
+	// inside the subtree it joins.
+	grown, _ := NewSkeleton(append(all, Node{"new", 1}), 4, 3)
+	d := Disruption(keys(20000),
+		func(k []byte) string { name, _ := s.Get(k); return name },
+		func(k []byte) string { name, _ := grown.Get(k); return name })
+	if d > 0.03 {
+		t.Errorf("ERROR: expected a few percent of keys at most to move but got %v", d)
+	}
+
+	empty, _ := NewSkeleton(nil, 4, 3)
+	if _, ok := empty.Get(key(0)); ok {
+		t.Errorf("ERROR: expected no node from an empty skeleton")
+	}
+}
@@ -0,0 +1,279 @@
+// Package ring implements consistent hashing on CityHash.
+//
+// A Ring places each node at a number of points on the 64-bit hash circle,
+// the virtual nodes, and maps a key to the node owning the first point at or
+// after the key's CityHash64. Adding or removing a node only moves the keys
+// between its points and their predecessors.
+//
+// The package also has jump consistent hashing, which needs no memory but
+// numbered buckets, and Maglev lookup tables for load balancers.
+package ring
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zentures/cityhash"
+)
+
+// DefaultVNodes is the number of points per unit of weight used by New.
+const DefaultVNodes = 160
+
+var (
+	ErrExists   = errors.New("ring: node already exists")
+	ErrNotFound = errors.New("ring: node not found")
+	ErrWeight   = errors.New("ring: weight must be positive")
+)
+
+// Node is a member of a ring. A node gets Weight times the ring's virtual
+// node count points, rounded, and at least one.
+type Node struct {
+	Name   string
+	Weight float64
+}
+
+// Range is a range of the hash circle whose keys moved from one node to
+// another: the keys whose CityHash64 h satisfies Start < h <= End, or, when
+// Start >= End, wraps around with h > Start or h <= End.
+type Range struct {
+	Start, End uint64
+	From, To   string
+}
+
+// Contains reports whether the hash h falls in the range.
+func (this Range) Contains(h uint64) bool {
+	if this.Start < this.End {
+		return h > this.Start && h <= this.End
+	}
+	return h > this.Start || h <= this.End
+}
+
+type point struct {
+	hash uint64
+	node string
+}
+
+// state is an immutable snapshot of a ring's membership.
+type state struct {
+	nodes  map[string]Node
+	weight float64 // total weight of the nodes
+	points []point // sorted by hash, then node
+}
+
+// search returns the index of the point owning hash h.
+func (this *state) search(h uint64) int {
+	i := sort.Search(len(this.points), func(i int) bool { return this.points[i].hash >= h })
+	if i == len(this.points) {
+		return 0
+	}
+	return i
+}
+
+func (this *state) owner(h uint64) string {
+	return this.points[this.search(h)].node
+}
+
+// Ring is a consistent hash ring. Lookups read an immutable snapshot and
+// never block; membership changes build a new snapshot under a mutex and
+// swap it in atomically. All methods are safe for concurrent use.
+type Ring struct {
+	vnodes int
+	mu     sync.Mutex // serialises writers
+	state  atomic.Pointer[state]
+}
+
+// New returns an empty ring with DefaultVNodes points per unit of weight.
+func New() *Ring {
+	return NewWithVNodes(DefaultVNodes)
+}
+
+// NewWithVNodes returns an empty ring with vnodes points per unit of weight.
+func NewWithVNodes(vnodes int) *Ring {
+	if vnodes < 1 {
+		vnodes = 1
+	}
+	this := &Ring{vnodes: vnodes}
+	this.state.Store(&state{nodes: map[string]Node{}})
+	return this
+}
+
+// Nodes returns the members of the ring, sorted by name.
+func (this *Ring) Nodes() []Node {
+	s := this.state.Load()
+	nodes := make([]Node, 0, len(s.nodes))
+	for _, n := range s.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes
+}
+
+// Len returns the number of nodes.
+func (this *Ring) Len() int {
+	return len(this.state.Load().nodes)
+}
+
+// Add adds a node and returns the ranges that moved to it. Adding the first
+// node moves no ranges, as no key had an owner before.
+func (this *Ring) Add(node Node) ([]Range, error) {
+	if !(node.Weight > 0) || math.IsInf(node.Weight, 1) {
+		return nil, ErrWeight
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	old := this.state.Load()
+	if _, ok := old.nodes[node.Name]; ok {
+		return nil, ErrExists
+	}
+
+	nodes := make(map[string]Node, len(old.nodes)+1)
+	for name, n := range old.nodes {
+		nodes[name] = n
+	}
+	nodes[node.Name] = node
+
+	return this.swap(old, nodes), nil
+}
+
+// Remove removes the named node and returns the ranges that moved away from
+// it. Removing the last node moves no ranges, as no key has an owner after.
+func (this *Ring) Remove(name string) ([]Range, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	old := this.state.Load()
+	if _, ok := old.nodes[name]; !ok {
+		return nil, ErrNotFound
+	}
+
+	nodes := make(map[string]Node, len(old.nodes))
+	for n, node := range old.nodes {
+		if n != name {
+			nodes[n] = node
+		}
+	}
+
+	return this.swap(old, nodes), nil
+}
+
+// swap publishes a snapshot of nodes and returns the ranges that changed
+// owner. It must be called with mu held.
+func (this *Ring) swap(old *state, nodes map[string]Node) []Range {
+	s := &state{nodes: nodes}
+	for _, n := range nodes {
+		s.weight += n.Weight
+		count := int(math.Round(n.Weight * float64(this.vnodes)))
+		if count < 1 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			h := cityhash.CityHash64WithSeed([]byte(n.Name), uint32(len(n.Name)), uint64(i))
+			s.points = append(s.points, point{h, n.Name})
+		}
+	}
+	sort.Slice(s.points, func(i, j int) bool {
+		a, b := s.points[i], s.points[j]
+		return a.hash < b.hash || (a.hash == b.hash && a.node < b.node)
+	})
+
+	this.state.Store(s)
+	return moved(old, s)
+}
+
+// moved returns the ranges whose owner differs between two snapshots, with
+// adjacent ranges between the same nodes merged.
+func moved(before, after *state) []Range {
+	if len(before.points) == 0 || len(after.points) == 0 {
+		return nil
+	}
+
+	var bounds []uint64
+	for _, p := range before.points {
+		bounds = append(bounds, p.hash)
+	}
+	for _, p := range after.points {
+		bounds = append(bounds, p.hash)
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	unique := bounds[:1]
+	for _, b := range bounds[1:] {
+		if b != unique[len(unique)-1] {
+			unique = append(unique, b)
+		}
+	}
+
+	// Each bound owns the range from the previous one, so both owners of a
+	// range are those of its end.
+	var ranges []Range
+	start := unique[len(unique)-1]
+	for _, end := range unique {
+		from, to := before.owner(end), after.owner(end)
+		if from != to {
+			if last := len(ranges) - 1; last >= 0 && ranges[last].End == start && ranges[last].From == from && ranges[last].To == to {
+				ranges[last].End = end
+			} else {
+				ranges = append(ranges, Range{start, end, from, to})
+			}
+		}
+		start = end
+	}
+
+	// The wrapping range may continue the last one.
+	if n := len(ranges); n > 1 && ranges[n-1].End == ranges[0].Start &&
+		ranges[n-1].From == ranges[0].From && ranges[n-1].To == ranges[0].To {
+		ranges[0].Start = ranges[n-1].Start
+		ranges = ranges[:n-1]
+	}
+	return ranges
+}
+
+// Get returns the node owning key, or false if the ring is empty.
+func (this *Ring) Get(key []byte) (string, bool) {
+	return this.GetHash(cityhash.CityHash64(key, uint32(len(key))))
+}
+
+// GetHash is like Get for a key's CityHash64 value.
+func (this *Ring) GetHash(h uint64) (string, bool) {
+	s := this.state.Load()
+	if len(s.points) == 0 {
+		return "", false
+	}
+	return s.owner(h), true
+}
+
+// GetN returns up to n distinct nodes for key, walking the ring clockwise
+// from its owner, for placing replicas. The first is the node Get returns.
+func (this *Ring) GetN(key []byte, n int) []string {
+	s := this.state.Load()
+	if len(s.points) == 0 || n < 1 {
+		return nil
+	}
+	if n > len(s.nodes) {
+		n = len(s.nodes)
+	}
+
+	nodes := make([]string, 0, n)
+	start := s.search(cityhash.CityHash64(key, uint32(len(key))))
+	for i := 0; i < len(s.points) && len(nodes) < n; i++ {
+		name := s.points[(start+i)%len(s.points)].node
+		if !contains(nodes, name) {
+			nodes = append(nodes, name)
+		}
+	}
+	return nodes
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package ring
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/zentures/cityhash"
+)
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("key-%d", i))
+}
+
+func TestGet(t *testing.T) {
+	r := New()
+	if _, ok := r.Get(key(0)); ok {
+		t.Errorf("ERROR: expected no node from an empty ring")
+	}
+
+	for _, n := range []Node{{"a", 1}, {"b", 1}, {"c", 2}} {
+		if _, err := r.Add(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Add(Node{"a", 1}); err != ErrExists {
+		t.Errorf("ERROR: expected ErrExists but got %v", err)
+	}
+	if _, err := r.Add(Node{"d", 0}); err != ErrWeight {
+		t.Errorf("ERROR: expected ErrWeight but got %v", err)
+	}
+	if _, err := r.Remove("d"); err != ErrNotFound {
+		t.Errorf("ERROR: expected ErrNotFound but got %v", err)
+	}
+
+	const n = 100000
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		node, _ := r.Get(key(i))
+		counts[node]++
+	}
+
+	// c has twice the weight, so about half of the keys.
+	for name, expected := range map[string]float64{"a": 0.25, "b": 0.25, "c": 0.5} {
+		if share := float64(counts[name]) / n; share < expected*0.8 || share > expected*1.2 {
+			t.Errorf("ERROR: expected %s to own about %v of the keys but got %v", name, expected, share)
+		}
+	}
+}
+
+func TestMoved(t *testing.T) {
+	r := NewWithVNodes(50)
+	for _, name := range []string{"a", "b", "c"} {
+		r.Add(Node{name, 1})
+	}
+
+	const n = 20000
+	owners := func() []string {
+		o := make([]string, n)
+		for i := range o {
+			o[i], _ = r.Get(key(i))
+		}
+		return o
+	}
+
+	check := func(op string, before, after []string, ranges []Range) {
+		moves := 0
+		for i := 0; i < n; i++ {
+			h := cityhash.CityHash64(key(i), uint32(len(key(i))))
+			var in *Range
+			for j := range ranges {
+				if ranges[j].Contains(h) {
+					in = &ranges[j]
+				}
+			}
+
+			switch {
+			case before[i] == after[i] && in != nil:
+				t.Fatalf("ERROR: %s: key %d stayed on %s but is in %v", op, i, after[i], *in)
+			case before[i] != after[i] && (in == nil || in.From != before[i] || in.To != after[i]):
+				t.Fatalf("ERROR: %s: key %d moved from %s to %s but the ranges say %v", op, i, before[i], after[i], in)
+			case before[i] != after[i]:
+				moves++
+			}
+		}
+
+		// Only about a quarter of the keys should move.
+		if moves == 0 || moves > n/3 {
+			t.Errorf("ERROR: %s: expected about %d keys to move but got %d", op, n/4, moves)
+		}
+	}
+
+	before := owners()
+	ranges, err := r.Add(Node{"d", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := owners()
+	check("add", before, after, ranges)
+	for _, rg := range ranges {
+		if rg.To != "d" {
+			t.Errorf("ERROR: expected every range to move to d but got %v", rg)
+		}
+	}
+
+	ranges, err = r.Remove("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("remove", after, owners(), ranges)
+}
+
+func TestGetN(t *testing.T) {
+	r := New()
+	if nodes := r.GetN(key(0), 2); nodes != nil {
+		t.Errorf("ERROR: expected no nodes from an empty ring but got %v", nodes)
+	}
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		r.Add(Node{name, 1})
+	}
+
+	for i := 0; i < 1000; i++ {
+		nodes := r.GetN(key(i), 3)
+		owner, _ := r.Get(key(i))
+		if len(nodes) != 3 || nodes[0] != owner || nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+			t.Fatalf("ERROR: expected 3 distinct nodes starting with %s but got %v", owner, nodes)
+		}
+	}
+
+	if nodes := r.GetN(key(0), 10); len(nodes) != 4 {
+		t.Errorf("ERROR: expected all 4 nodes but got %v", nodes)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	r := New()
+	r.Add(Node{"base", 1})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				if _, ok := r.Get(key(i)); !ok {
+					t.Errorf("ERROR: expected a node during membership changes")
+					return
+				}
+				r.GetN(key(i), 2)
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("node-%d", i)
+		r.Add(Node{name, 1})
+		if i%2 == 0 {
+			r.Remove(name)
+		}
+	}
+	wg.Wait()
+
+	if r.Len() != 11 {
+		t.Errorf("ERROR: expected 11 nodes but got %d", r.Len())
+	}
+}
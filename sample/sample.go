@@ -0,0 +1,167 @@
+// Package sample decides which records to keep by hashing their keys, so that
+// every process sampling the same keys at the same rate keeps the same ones.
+//
+// A Threshold sampler at rate r keeps a key if
+//
+//	CityHash64(key) < floor(r * 2^64)
+//
+// and keeps everything at rate 1. A Seeded sampler uses CityHash64WithSeed
+// instead, for samples independent of other samplers. Samplers at a higher
+// rate keep a superset of the keys kept at a lower one.
+package sample
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	"github.com/zentures/cityhash"
+)
+
+// Sampler decides whether to keep a record with the given key.
+type Sampler interface {
+	Sample(key []byte) bool
+}
+
+func threshold(rate float64) (uint64, bool) {
+	if rate >= 1 {
+		return math.MaxUint64, true
+	}
+	if !(rate > 0) {
+		return 0, false
+	}
+	return uint64(rate * (1 << 64)), false
+}
+
+// Threshold keeps the keys whose CityHash64 falls below a threshold.
+type Threshold struct {
+	threshold uint64
+	all       bool
+}
+
+// NewThreshold returns a sampler keeping a fraction rate of the keys.
+func NewThreshold(rate float64) *Threshold {
+	t, all := threshold(rate)
+	return &Threshold{t, all}
+}
+
+func (this *Threshold) Sample(key []byte) bool {
+	return this.all || cityhash.CityHash64(key, uint32(len(key))) < this.threshold
+}
+
+// Seeded keeps the keys whose CityHash64WithSeed falls below a threshold.
+type Seeded struct {
+	seed      uint64
+	threshold uint64
+	all       bool
+}
+
+// NewSeeded returns a sampler keeping a fraction rate of the keys, chosen by
+// seed.
+func NewSeeded(rate float64, seed uint64) *Seeded {
+	t, all := threshold(rate)
+	return &Seeded{seed, t, all}
+}
+
+func (this *Seeded) Sample(key []byte) bool {
+	return this.all || cityhash.CityHash64WithSeed(key, uint32(len(key)), this.seed) < this.threshold
+}
+
+// Item is a record kept by a Priority sampler.
+type Item struct {
+	Key      string
+	Weight   float64
+	Estimate float64 // unbiased estimate of the weight this item stands for
+}
+
+// Priority keeps k of the records with the highest priorities weight/u, where
+// u in (0, 1) comes from the CityHash64 of the key (Duffield, Lund and
+// Thorup, "Priority sampling for estimation of arbitrary subset sums"). With
+// unit weights it is a bottom-k sample: the k smallest hashes. The sum of
+// Estimate over the kept items of any subset is an unbiased estimate of the
+// subset's total weight. Keys are assumed distinct. It is not safe for
+// concurrent use.
+type Priority struct {
+	k     int
+	items priorityHeap // the k+1 highest priorities, lowest first
+}
+
+// NewPriority returns a sampler keeping k records.
+func NewPriority(k int) *Priority {
+	if k < 1 {
+		k = 1
+	}
+	return &Priority{k: k}
+}
+
+type prioritized struct {
+	key      string
+	weight   float64
+	priority float64
+}
+
+// Add offers a record with a positive weight.
+func (this *Priority) Add(key []byte, weight float64) {
+	if !(weight > 0) {
+		return
+	}
+
+	h := cityhash.CityHash64(key, uint32(len(key)))
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	p := weight / u
+
+	if len(this.items) <= this.k {
+		heap.Push(&this.items, prioritized{string(key), weight, p})
+	} else if p > this.items[0].priority {
+		this.items[0] = prioritized{string(key), weight, p}
+		heap.Fix(&this.items, 0)
+	}
+}
+
+// Threshold returns the (k+1)th highest priority, or 0 while at most k
+// records have been offered and the sample is exact.
+func (this *Priority) Threshold() float64 {
+	if len(this.items) <= this.k {
+		return 0
+	}
+	return this.items[0].priority
+}
+
+// Sample returns the kept records, highest priority first.
+func (this *Priority) Sample() []Item {
+	kept := append([]prioritized(nil), this.items...)
+	sort.Slice(kept, func(i, j int) bool { return kept[i].priority > kept[j].priority })
+	if len(kept) > this.k {
+		kept = kept[:this.k]
+	}
+
+	tau := this.Threshold()
+	items := make([]Item, len(kept))
+	for i, p := range kept {
+		items[i] = Item{p.key, p.weight, math.Max(p.weight, tau)}
+	}
+	return items
+}
+
+// Total returns the estimated total weight of all records offered.
+func (this *Priority) Total() float64 {
+	total := 0.0
+	for _, item := range this.Sample() {
+		total += item.Estimate
+	}
+	return total
+}
+
+type priorityHeap []prioritized
+
+func (this priorityHeap) Len() int            { return len(this) }
+func (this priorityHeap) Less(i, j int) bool  { return this[i].priority < this[j].priority }
+func (this priorityHeap) Swap(i, j int)       { this[i], this[j] = this[j], this[i] }
+func (this *priorityHeap) Push(x interface{}) { *this = append(*this, x.(prioritized)) }
+
+func (this *priorityHeap) Pop() interface{} {
+	old := *this
+	x := old[len(old)-1]
+	*this = old[:len(old)-1]
+	return x
+}
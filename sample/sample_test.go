@@ -0,0 +1,112 @@
+package sample
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("trace-%d", i))
+}
+
+func TestThreshold(t *testing.T) {
+	const n = 100000
+	samplers := map[string]func(rate float64) Sampler{
+		"threshold": func(rate float64) Sampler { return NewThreshold(rate) },
+		"seeded":    func(rate float64) Sampler { return NewSeeded(rate, 42) },
+	}
+
+	for name, newSampler := range samplers {
+		low, high := newSampler(0.01), newSampler(0.1)
+		var kept, keptHigh int
+		for i := 0; i < n; i++ {
+			l, h := low.Sample(key(i)), high.Sample(key(i))
+			if l && !h {
+				t.Fatalf("ERROR: %s: key %d kept at 1%% but not at 10%%", name, i)
+			}
+			if l {
+				kept++
+			}
+			if h {
+				keptHigh++
+			}
+		}
+		if math.Abs(float64(kept)-n*0.01) > 100 || math.Abs(float64(keptHigh)-n*0.1) > 300 {
+			t.Errorf("ERROR: %s: expected about 1000 and 10000 kept but got %d and %d", name, kept, keptHigh)
+		}
+
+		if newSampler(0).Sample(key(0)) || !newSampler(1).Sample(key(0)) {
+			t.Errorf("ERROR: %s: expected rate 0 to keep nothing and rate 1 everything", name)
+		}
+	}
+
+	// Seeds choose independent samples.
+	a, b := NewSeeded(0.5, 1), NewSeeded(0.5, 2)
+	same := 0
+	for i := 0; i < 10000; i++ {
+		if a.Sample(key(i)) == b.Sample(key(i)) {
+			same++
+		}
+	}
+	if same < 4700 || same > 5300 {
+		t.Errorf("ERROR: expected seeds to agree on about half the keys but got %d of 10000", same)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	// While no more than k records are offered the sample is exact.
+	p := NewPriority(10)
+	for i := 0; i < 5; i++ {
+		p.Add(key(i), float64(i+1))
+	}
+	if len(p.Sample()) != 5 || p.Total() != 15 || p.Threshold() != 0 {
+		t.Errorf("ERROR: expected an exact sample totalling 15 but got %v", p.Sample())
+	}
+
+	// Averaged over independent samples, the estimate of a subset's weight
+	// matches its true weight.
+	const trials, n, k = 200, 1000, 50
+	var estimate, truth float64
+	for trial := 0; trial < trials; trial++ {
+		p := NewPriority(k)
+		truth = 0
+		for i := 0; i < n; i++ {
+			w := float64(1 + i%10)
+			p.Add([]byte(fmt.Sprintf("%d/%d", trial, i)), w)
+			if i%3 == 0 {
+				truth += w
+			}
+		}
+
+		sample := p.Sample()
+		if len(sample) != k {
+			t.Fatalf("ERROR: expected %d items but got %d", k, len(sample))
+		}
+		for _, item := range sample {
+			var tr, i int
+			fmt.Sscanf(item.Key, "%d/%d", &tr, &i)
+			if i%3 == 0 {
+				estimate += item.Estimate
+			}
+		}
+	}
+	if estimate /= trials; math.Abs(estimate-truth) > truth*0.05 {
+		t.Errorf("ERROR: expected a mean estimate of about %v but got %v", truth, estimate)
+	}
+
+	// With unit weights it keeps the smallest hashes.
+	unit, bottom := NewPriority(100), NewThreshold(0.01)
+	for i := 0; i < 10000; i++ {
+		unit.Add(key(i), 1)
+	}
+	inBottom := 0
+	for _, item := range unit.Sample() {
+		if bottom.Sample([]byte(item.Key)) {
+			inBottom++
+		}
+	}
+	if inBottom < 70 {
+		t.Errorf("ERROR: expected most of the bottom-100 in the 1%% sample but got %d", inBottom)
+	}
+}
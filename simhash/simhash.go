@@ -0,0 +1,204 @@
+// Package simhash computes 64-bit SimHash fingerprints (Charikar) of weighted
+// features hashed with CityHash64, and finds fingerprints within a small
+// Hamming distance with the permuted tables of Manku et al., "Detecting
+// Near-Duplicates for Web Crawling".
+package simhash
+
+import (
+	"errors"
+	"math/bits"
+	"sort"
+	"sync"
+
+	"github.com/zentures/cityhash"
+)
+
+var ErrDistance = errors.New("simhash: distance must be between 0 and 3")
+
+// Feature is a token, shingle or other feature of a document with its weight.
+type Feature struct {
+	Value  string
+	Weight float64
+}
+
+// Weights returns the distinct tokens as features weighted by term
+// frequency, multiplied by idf[token] when idf is non-nil. Tokens missing
+// from idf keep their term frequency. Features are sorted by value.
+func Weights(tokens []string, idf map[string]float64) []Feature {
+	tf := make(map[string]float64)
+	for _, t := range tokens {
+		tf[t]++
+	}
+
+	features := make([]Feature, 0, len(tf))
+	for t, n := range tf {
+		if w, ok := idf[t]; ok {
+			n *= w
+		}
+		features = append(features, Feature{t, n})
+	}
+
+	sort.Slice(features, func(i, j int) bool { return features[i].Value < features[j].Value })
+	return features
+}
+
+// Fingerprint returns the SimHash of the features: bit i is set if the
+// features whose CityHash64 has bit i set outweigh those where it is clear.
+func Fingerprint(features []Feature) uint64 {
+	var v [64]float64
+	for _, f := range features {
+		h := cityhash.CityHash64([]byte(f.Value), uint32(len(f.Value)))
+		for i := range v {
+			if h&(1<<uint(i)) != 0 {
+				v[i] += f.Weight
+			} else {
+				v[i] -= f.Weight
+			}
+		}
+	}
+
+	var fp uint64
+	for i := range v {
+		if v[i] > 0 {
+			fp |= 1 << uint(i)
+		}
+	}
+	return fp
+}
+
+// Distance returns the Hamming distance between two fingerprints.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Index finds the stored fingerprints within Hamming distance k of a query.
+// It splits fingerprints into k+1 blocks; two fingerprints within distance k
+// agree on at least one block. Table i keeps every fingerprint rotated so that
+// block i leads, sorted, and a query scans the run sharing its leading block.
+// Add only appends; the tables are sorted by the first Len or Query after a
+// run of Adds, or by Add itself once the pending fingerprints outnumber the
+// sorted ones, so building an index of n fingerprints costs O(n log n) and
+// repeated fingerprints cannot grow it without bound. It is safe for
+// concurrent use.
+type Index struct {
+	k      int
+	starts []int // first bit of each block, counted from the top
+	widths []int // width of each block
+
+	mu     sync.RWMutex
+	tables [][]uint64 // rotated fingerprints
+	sorted int        // length of the sorted, distinct prefix of each table
+}
+
+// minPending is how many Adds may be pending beyond the sorted fingerprints
+// before Add sorts the tables itself.
+const minPending = 1024
+
+// NewIndex returns an empty index for queries within Hamming distance k.
+func NewIndex(k int) (*Index, error) {
+	if k < 0 || k > 3 {
+		return nil, ErrDistance
+	}
+
+	this := &Index{
+		k:      k,
+		starts: make([]int, k+1),
+		widths: make([]int, k+1),
+		tables: make([][]uint64, k+1),
+	}
+
+	start := 0
+	for i := range this.widths {
+		this.starts[i] = start
+		this.widths[i] = 64 / (k + 1)
+		if i < 64%(k+1) {
+			this.widths[i]++
+		}
+		start += this.widths[i]
+	}
+	return this, nil
+}
+
+// Len returns the number of distinct fingerprints in the index.
+func (this *Index) Len() int {
+	this.rlock()
+	defer this.mu.RUnlock()
+	return len(this.tables[0])
+}
+
+// Add stores fp. Adding a fingerprint already in the index does nothing.
+func (this *Index) Add(fp uint64) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for i := range this.tables {
+		this.tables[i] = append(this.tables[i], bits.RotateLeft64(fp, this.starts[i]))
+	}
+	if len(this.tables[0])-this.sorted > this.sorted+minPending {
+		this.prepare()
+	}
+}
+
+// rlock read-locks the index once no Adds are pending, sorting the tables
+// under the write lock first if need be.
+func (this *Index) rlock() {
+	for {
+		this.mu.RLock()
+		if this.sorted == len(this.tables[0]) {
+			return
+		}
+		this.mu.RUnlock()
+
+		this.mu.Lock()
+		this.prepare()
+		this.mu.Unlock()
+	}
+}
+
+// prepare sorts the tables and drops duplicates after Adds. The caller holds
+// the write lock.
+func (this *Index) prepare() {
+	if this.sorted == len(this.tables[0]) {
+		return
+	}
+
+	for i, table := range this.tables {
+		sort.Slice(table, func(a, b int) bool { return table[a] < table[b] })
+		n := 0
+		for j, p := range table {
+			if j == 0 || p != table[n-1] {
+				table[n] = p
+				n++
+			}
+		}
+		this.tables[i] = table[:n]
+	}
+	this.sorted = len(this.tables[0])
+}
+
+// Query returns the stored fingerprints within distance k of fp, sorted.
+func (this *Index) Query(fp uint64) []uint64 {
+	this.rlock()
+	defer this.mu.RUnlock()
+
+	seen := make(map[uint64]bool)
+	var matches []uint64
+
+	for i, table := range this.tables {
+		p := bits.RotateLeft64(fp, this.starts[i])
+		shift := uint(64 - this.widths[i])
+		prefix := p >> shift
+
+		j := sort.Search(len(table), func(j int) bool { return table[j]>>shift >= prefix })
+		for ; j < len(table) && table[j]>>shift == prefix; j++ {
+			candidate := bits.RotateLeft64(table[j], -this.starts[i])
+			if !seen[candidate] && Distance(candidate, fp) <= this.k {
+				seen[candidate] = true
+				matches = append(matches, candidate)
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i] < matches[j] })
+	return matches
+}
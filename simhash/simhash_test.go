@@ -0,0 +1,162 @@
+package simhash
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	doc := strings.Fields(strings.Repeat("the quick brown fox jumps over the lazy dog ", 3) + "and then some more words follow here")
+	a := Fingerprint(Weights(doc, nil))
+
+	near := append(append([]string{}, doc...), "extra")
+	if d := Distance(a, Fingerprint(Weights(near, nil))); d > 8 {
+		t.Errorf("ERROR: expected a small distance for a near duplicate but got %d", d)
+	}
+
+	other := strings.Fields("completely unrelated text about cooking pasta with garlic and olive oil tonight")
+	if d := Distance(a, Fingerprint(Weights(other, nil))); d < 16 {
+		t.Errorf("ERROR: expected a large distance for unrelated text but got %d", d)
+	}
+
+	// A single feature reproduces its own hash.
+	if fp := Fingerprint([]Feature{{"x", 1}}); fp != Fingerprint(Weights([]string{"x", "x"}, nil)) {
+		t.Errorf("ERROR: expected weighting not to change a single feature's fingerprint")
+	}
+
+	w := Weights([]string{"a", "b", "a"}, map[string]float64{"a": 0.5})
+	if len(w) != 2 || w[0] != (Feature{"a", 1}) || w[1] != (Feature{"b", 1}) {
+		t.Errorf("ERROR: unexpected weights %v", w)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	if _, err := NewIndex(4); err != ErrDistance {
+		t.Errorf("ERROR: expected ErrDistance but got %v", err)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for k := 0; k <= 3; k++ {
+		index, err := NewIndex(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored := make([]uint64, 5000)
+		for i := range stored {
+			stored[i] = rnd.Uint64()
+			index.Add(stored[i])
+		}
+		index.Add(stored[0])
+		if index.Len() != len(stored) {
+			t.Errorf("ERROR: expected %d fingerprints but got %d", len(stored), index.Len())
+		}
+
+		for q := 0; q < 200; q++ {
+			fp := stored[rnd.Intn(len(stored))]
+			for flips := rnd.Intn(k + 2); flips > 0; flips-- {
+				fp ^= 1 << uint(rnd.Intn(64))
+			}
+
+			var expected []uint64
+			for _, s := range stored {
+				if Distance(s, fp) <= k {
+					expected = append(expected, s)
+				}
+			}
+			sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+
+			if got := index.Query(fp); fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Fatalf("ERROR: k=%d: expected %v but got %v", k, expected, got)
+			}
+		}
+	}
+}
+
+func TestIndexInterleaved(t *testing.T) {
+	index, _ := NewIndex(2)
+	index.Add(0xff)
+	if got := index.Query(0xfe); len(got) != 1 || got[0] != 0xff {
+		t.Errorf("ERROR: expected [0xff] but got %x", got)
+	}
+
+	// Adds after a Query are seen by the next one.
+	index.Add(0xfc)
+	index.Add(0xff)
+	if got := index.Query(0xfe); len(got) != 2 || got[0] != 0xfc || got[1] != 0xff {
+		t.Errorf("ERROR: expected [0xfc 0xff] but got %x", got)
+	}
+	if index.Len() != 2 {
+		t.Errorf("ERROR: expected 2 fingerprints but got %d", index.Len())
+	}
+}
+
+func TestIndexRepeated(t *testing.T) {
+	index, _ := NewIndex(3)
+	for i := 0; i < 100000; i++ {
+		index.Add(uint64(i % 10))
+	}
+
+	// Pending duplicates are dropped as they pile up, not only on Query.
+	if n := len(index.tables[0]); n > 10+minPending+1 {
+		t.Errorf("ERROR: expected at most %d pending fingerprints but got %d", 10+minPending+1, n)
+	}
+	if index.Len() != 10 {
+		t.Errorf("ERROR: expected 10 fingerprints but got %d", index.Len())
+	}
+}
+
+func TestIndexConcurrent(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	fps := make([]uint64, 1100)
+	for i := range fps {
+		fps[i] = rnd.Uint64()
+	}
+
+	index, _ := NewIndex(3)
+	for _, fp := range fps[:1000] {
+		index.Add(fp)
+	}
+
+	// Queries right after the Adds race to sort the tables; run with -race.
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if got := index.Query(fps[i] ^ 1); len(got) != 1 || got[0] != fps[i] {
+					t.Errorf("ERROR: expected [%x] but got %x", fps[i], got)
+				}
+				if w == 0 {
+					index.Add(fps[1000+i])
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if index.Len() != 1100 {
+		t.Errorf("ERROR: expected 1100 fingerprints but got %d", index.Len())
+	}
+}
+
+func BenchmarkIndexBuild(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	fps := make([]uint64, 200000)
+	for i := range fps {
+		fps[i] = rnd.Uint64()
+	}
+
+	for i := 0; i < b.N; i++ {
+		index, _ := NewIndex(3)
+		for _, fp := range fps {
+			index.Add(fp)
+		}
+		index.Query(fps[0])
+	}
+}
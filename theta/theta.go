@@ -0,0 +1,275 @@
+// Package theta implements a KMV / Theta sketch of CityHash64 values, after
+// Dasgupta et al., "A Framework for Estimating Stream Expression Cardinalities".
+//
+// A sketch keeps the hashes below a threshold theta, at most k of them. While
+// fewer than k distinct hashes have been seen, theta is 2^64 and the count is
+// exact. Unlike HyperLogLog, sketches support intersection and difference as
+// well as union, and the results are sketches themselves.
+package theta
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/zentures/cityhash"
+)
+
+// DefaultK gives a relative standard error of about 1/sqrt(4096), or 1.6%.
+const DefaultK = 4096
+
+var (
+	ErrSize    = errors.New("theta: k must be positive")
+	ErrInvalid = errors.New("theta: invalid encoding")
+)
+
+// Sketch is a Theta sketch. It is not safe for concurrent use.
+type Sketch struct {
+	k      int
+	theta  uint64 // hashes >= theta are dropped; math.MaxUint64 until full
+	hashes map[uint64]struct{}
+	order  maxHeap // the retained hashes, largest first
+}
+
+// New returns an empty sketch that retains up to k hashes.
+func New(k int) (*Sketch, error) {
+	if k < 1 {
+		return nil, ErrSize
+	}
+	return newSketch(k, math.MaxUint64, nil), nil
+}
+
+// newSketch builds a sketch from hashes, which must all be below theta,
+// keeping the k smallest.
+func newSketch(k int, theta uint64, hashes []uint64) *Sketch {
+	if len(hashes) > k {
+		sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+		theta, hashes = hashes[k], hashes[:k]
+	}
+
+	this := &Sketch{
+		k:      k,
+		theta:  theta,
+		hashes: make(map[uint64]struct{}, len(hashes)),
+		order:  append(maxHeap(nil), hashes...),
+	}
+	for _, h := range hashes {
+		this.hashes[h] = struct{}{}
+	}
+	heap.Init(&this.order)
+	return this
+}
+
+func (this *Sketch) K() int {
+	return this.k
+}
+
+// Theta returns the sampling threshold as a fraction of the hash space.
+func (this *Sketch) Theta() float64 {
+	if this.theta == math.MaxUint64 {
+		return 1
+	}
+	return float64(this.theta) / (1 << 64)
+}
+
+// Retained returns the number of hashes kept.
+func (this *Sketch) Retained() int {
+	return len(this.hashes)
+}
+
+// Update adds key, hashed with CityHash64.
+func (this *Sketch) Update(key []byte) {
+	this.UpdateHash(cityhash.CityHash64(key, uint32(len(key))))
+}
+
+// UpdateHash adds an item by its CityHash64 value, for callers that already
+// hold it.
+func (this *Sketch) UpdateHash(h uint64) {
+	if h >= this.theta {
+		return
+	}
+	if _, ok := this.hashes[h]; ok {
+		return
+	}
+
+	this.hashes[h] = struct{}{}
+	heap.Push(&this.order, h)
+
+	if len(this.hashes) > this.k {
+		this.theta = heap.Pop(&this.order).(uint64)
+		delete(this.hashes, this.theta)
+	}
+}
+
+// Estimate returns the estimated number of distinct items.
+func (this *Sketch) Estimate() float64 {
+	return float64(len(this.hashes)) / this.Theta()
+}
+
+// LowerBound returns a lower bound on the number of distinct items at
+// numStdDev standard deviations, from the normal approximation to the
+// binomial number of retained hashes. It is never below the retained count.
+func (this *Sketch) LowerBound(numStdDev float64) float64 {
+	return math.Max(float64(len(this.hashes)), this.Estimate()-numStdDev*this.stdDev())
+}
+
+// UpperBound returns an upper bound on the number of distinct items at
+// numStdDev standard deviations.
+func (this *Sketch) UpperBound(numStdDev float64) float64 {
+	return this.Estimate() + numStdDev*this.stdDev()
+}
+
+func (this *Sketch) stdDev() float64 {
+	t := this.Theta()
+	return math.Sqrt(this.Estimate() * (1 - t) / t)
+}
+
+// sorted returns the retained hashes in increasing order.
+func (this *Sketch) sorted() []uint64 {
+	hashes := make([]uint64, 0, len(this.hashes))
+	for h := range this.hashes {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	return hashes
+}
+
+func minTheta(sketches []*Sketch) uint64 {
+	theta := uint64(math.MaxUint64)
+	for _, s := range sketches {
+		if s.theta < theta {
+			theta = s.theta
+		}
+	}
+	return theta
+}
+
+// Union returns a sketch of at most k hashes of the union of the sketches.
+func Union(k int, sketches ...*Sketch) *Sketch {
+	theta := minTheta(sketches)
+
+	seen := make(map[uint64]struct{})
+	var hashes []uint64
+	for _, s := range sketches {
+		for h := range s.hashes {
+			if _, ok := seen[h]; !ok && h < theta {
+				seen[h] = struct{}{}
+				hashes = append(hashes, h)
+			}
+		}
+	}
+	return newSketch(k, theta, hashes)
+}
+
+// Intersection returns a sketch of the items in every one of the sketches.
+// Its k is the smallest of theirs.
+func Intersection(sketches ...*Sketch) *Sketch {
+	if len(sketches) == 0 {
+		return newSketch(DefaultK, math.MaxUint64, nil)
+	}
+
+	theta, k := minTheta(sketches), sketches[0].k
+	for _, s := range sketches[1:] {
+		if s.k < k {
+			k = s.k
+		}
+	}
+
+	var hashes []uint64
+outer:
+	for h := range sketches[0].hashes {
+		if h >= theta {
+			continue
+		}
+		for _, s := range sketches[1:] {
+			if _, ok := s.hashes[h]; !ok {
+				continue outer
+			}
+		}
+		hashes = append(hashes, h)
+	}
+	return newSketch(k, theta, hashes)
+}
+
+// AnotB returns a sketch of the items in a that are not in b.
+func AnotB(a, b *Sketch) *Sketch {
+	theta := minTheta([]*Sketch{a, b})
+
+	var hashes []uint64
+	for h := range a.hashes {
+		if _, ok := b.hashes[h]; !ok && h < theta {
+			hashes = append(hashes, h)
+		}
+	}
+	return newSketch(a.k, theta, hashes)
+}
+
+// The encoding is, little endian throughout:
+//
+//	magic    [4]byte "CHTS"
+//	version  uint8   1
+//	         [3]byte reserved, zero
+//	k        uint32
+//	count    uint32
+//	theta    uint64  2^64-1 while exact
+//
+// followed by count uint64 hashes in increasing order, all below theta.
+const headerSize = 24
+
+var magic = [4]byte{'C', 'H', 'T', 'S'}
+
+func (this *Sketch) MarshalBinary() ([]byte, error) {
+	b := make([]byte, headerSize, headerSize+8*len(this.hashes))
+	copy(b, magic[:])
+	b[4] = 1
+	binary.LittleEndian.PutUint32(b[8:], uint32(this.k))
+	binary.LittleEndian.PutUint32(b[12:], uint32(len(this.hashes)))
+	binary.LittleEndian.PutUint64(b[16:], this.theta)
+
+	for _, h := range this.sorted() {
+		b = binary.LittleEndian.AppendUint64(b, h)
+	}
+	return b, nil
+}
+
+func (this *Sketch) UnmarshalBinary(b []byte) error {
+	if len(b) < headerSize || [4]byte(b[:4]) != magic || b[4] != 1 {
+		return ErrInvalid
+	}
+
+	k := binary.LittleEndian.Uint32(b[8:])
+	n := binary.LittleEndian.Uint32(b[12:])
+	theta := binary.LittleEndian.Uint64(b[16:])
+	b = b[headerSize:]
+
+	if k < 1 || k > math.MaxInt32 || n > k || uint64(len(b)) != 8*uint64(n) {
+		return ErrInvalid
+	}
+
+	hashes := make([]uint64, n)
+	for i := range hashes {
+		hashes[i] = binary.LittleEndian.Uint64(b[8*i:])
+		if hashes[i] >= theta || (i > 0 && hashes[i] <= hashes[i-1]) {
+			return ErrInvalid
+		}
+	}
+
+	*this = *newSketch(int(k), theta, hashes)
+	return nil
+}
+
+type maxHeap []uint64
+
+func (this maxHeap) Len() int            { return len(this) }
+func (this maxHeap) Less(i, j int) bool  { return this[i] > this[j] }
+func (this maxHeap) Swap(i, j int)       { this[i], this[j] = this[j], this[i] }
+func (this *maxHeap) Push(x interface{}) { *this = append(*this, x.(uint64)) }
+
+func (this *maxHeap) Pop() interface{} {
+	old := *this
+	x := old[len(old)-1]
+	*this = old[:len(old)-1]
+	return x
+}
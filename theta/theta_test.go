@@ -0,0 +1,94 @@
+package theta
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("user-%d", i))
+}
+
+func fill(t *testing.T, k, from, to int) *Sketch {
+	s, err := New(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := from; i < to; i++ {
+		s.Update(key(i))
+	}
+	return s
+}
+
+func checkEstimate(t *testing.T, name string, s *Sketch, expected float64) {
+	if lo, hi := s.LowerBound(3), s.UpperBound(3); expected < lo || expected > hi {
+		t.Errorf("ERROR: %s: expected %v within [%v, %v] (estimate %v)", name, expected, lo, hi, s.Estimate())
+	}
+}
+
+func TestExact(t *testing.T) {
+	if _, err := New(0); err != ErrSize {
+		t.Errorf("ERROR: expected ErrSize but got %v", err)
+	}
+
+	s := fill(t, 1024, 0, 1000)
+	s.Update(key(5))
+	if s.Estimate() != 1000 || s.Theta() != 1 || s.LowerBound(2) != 1000 || s.UpperBound(2) != 1000 {
+		t.Errorf("ERROR: expected an exact count of 1000 but got %v", s.Estimate())
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	const k = 4096
+	a := fill(t, k, 0, 100000)     // A: [0, 100000)
+	b := fill(t, k, 60000, 200000) // B: [60000, 200000)
+
+	if a.Retained() != k {
+		t.Errorf("ERROR: expected %d retained hashes but got %d", k, a.Retained())
+	}
+
+	checkEstimate(t, "A", a, 100000)
+	checkEstimate(t, "A or B", Union(k, a, b), 200000)
+	checkEstimate(t, "A and B", Intersection(a, b), 40000)
+	checkEstimate(t, "A not B", AnotB(a, b), 60000)
+
+	if e := Intersection(a, fill(t, k, 300000, 400000)).Estimate(); e != 0 {
+		t.Errorf("ERROR: expected an empty intersection but got %v", e)
+	}
+
+	// The union of disjoint halves matches a sketch of the whole.
+	u := Union(k, fill(t, k, 0, 50000), fill(t, k, 50000, 100000))
+	if u.Estimate() != a.Estimate() {
+		t.Errorf("ERROR: expected the union to equal the whole: %v != %v", u.Estimate(), a.Estimate())
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	for _, n := range []int{0, 10, 50000} {
+		s := fill(t, 1024, 0, n)
+		b, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var r Sketch
+		if err = r.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		if r.Estimate() != s.Estimate() || r.K() != s.K() || math.Abs(r.Theta()-s.Theta()) > 0 {
+			t.Errorf("ERROR: expected estimate %v but got %v", s.Estimate(), r.Estimate())
+		}
+
+		// The decoded sketch keeps working.
+		r.Update(key(n))
+		s.Update(key(n))
+		if r.Estimate() != s.Estimate() {
+			t.Errorf("ERROR: expected estimate %v after an update but got %v", s.Estimate(), r.Estimate())
+		}
+
+		if err = r.UnmarshalBinary(b[:len(b)-1]); err != ErrInvalid {
+			t.Errorf("ERROR: expected ErrInvalid for a truncated sketch but got %v", err)
+		}
+	}
+}
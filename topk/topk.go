@@ -0,0 +1,152 @@
+// Package topk tracks the most frequent keys of a stream with the
+// Space-Saving algorithm of Metwally et al., "Efficient Computation of
+// Frequent and Top-k Elements in Data Streams".
+//
+// Keys are identified by their CityHash64 fingerprint; the key itself is kept
+// only for reporting. Two keys with the same fingerprint are counted as one.
+package topk
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/zentures/cityhash"
+)
+
+// Item is a tracked key. Its true count lies between Count-Error and Count.
+// Guaranteed is set if the key is certainly among the true top k.
+type Item struct {
+	Key        string
+	Count      float64
+	Error      float64
+	Guaranteed bool
+}
+
+type counter struct {
+	fp    uint64
+	key   string
+	count float64
+	err   float64
+	index int // position in the heap
+}
+
+type minHeap []*counter
+
+func (this minHeap) Len() int           { return len(this) }
+func (this minHeap) Less(i, j int) bool { return this[i].count < this[j].count }
+func (this minHeap) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+	this[i].index = i
+	this[j].index = j
+}
+func (this *minHeap) Push(x interface{}) {
+	c := x.(*counter)
+	c.index = len(*this)
+	*this = append(*this, c)
+}
+func (this *minHeap) Pop() interface{} {
+	old := *this
+	c := old[len(old)-1]
+	*this = old[:len(old)-1]
+	return c
+}
+
+// TopK reports the k most frequent keys, monitoring a fixed number of
+// counters. More counters than k make the reported counts and ranking more
+// reliable. It is not safe for concurrent use.
+type TopK struct {
+	k        int
+	capacity int
+	counters map[uint64]*counter
+	heap     minHeap
+}
+
+// New returns a tracker of the top k keys, at least 1, that monitors
+// capacity counters, at least k.
+func New(k, capacity int) *TopK {
+	if k < 1 {
+		k = 1
+	}
+	if capacity < k {
+		capacity = k
+	}
+
+	return &TopK{
+		k:        k,
+		capacity: capacity,
+		counters: make(map[uint64]*counter, capacity),
+		heap:     make(minHeap, 0, capacity),
+	}
+}
+
+// Add counts one occurrence of key.
+func (this *TopK) Add(key []byte) {
+	this.AddN(key, 1)
+}
+
+// AddN counts n occurrences of key.
+func (this *TopK) AddN(key []byte, n float64) {
+	fp := cityhash.CityHash64(key, uint32(len(key)))
+
+	if c, ok := this.counters[fp]; ok {
+		c.count += n
+		heap.Fix(&this.heap, c.index)
+		return
+	}
+
+	if len(this.heap) < this.capacity {
+		c := &counter{fp: fp, key: string(key), count: n}
+		this.counters[fp] = c
+		heap.Push(&this.heap, c)
+		return
+	}
+
+	// Take over the smallest counter; its count bounds how often the new key
+	// may have been seen while unmonitored.
+	c := this.heap[0]
+	delete(this.counters, c.fp)
+	c.fp, c.key, c.err = fp, string(key), c.count
+	c.count += n
+	this.counters[fp] = c
+	heap.Fix(&this.heap, 0)
+}
+
+// Decay multiplies all counts and errors by factor, between 0 and 1, so that
+// older occurrences weigh less than recent ones.
+func (this *TopK) Decay(factor float64) {
+	for _, c := range this.heap {
+		c.count *= factor
+		c.err *= factor
+	}
+}
+
+// Snapshot returns the top k items, most frequent first.
+func (this *TopK) Snapshot() []Item {
+	items := make([]Item, 0, len(this.heap))
+	for _, c := range this.heap {
+		items = append(items, Item{Key: c.key, Count: c.count, Error: c.err})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Key < items[j].Key
+	})
+
+	// Every key ranked below the snapshot, monitored or not, has been seen at
+	// most threshold times.
+	var threshold float64
+	if len(this.heap) == this.capacity {
+		threshold = this.heap[0].count
+	}
+	if len(items) > this.k {
+		threshold = items[this.k].Count
+		items = items[:this.k]
+	}
+
+	for i := range items {
+		items[i].Guaranteed = items[i].Count-items[i].Error >= threshold
+	}
+	return items
+}
@@ -0,0 +1,80 @@
+package topk
+
+import (
+	"fmt"
+	"testing"
+)
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("tenant-%d", i))
+}
+
+func TestTopK(t *testing.T) {
+	tk := New(5, 50)
+
+	// Key i appears 10000/(i+1) times, interleaved with a long tail.
+	for round := 0; round < 100; round++ {
+		for i := 0; i < 20; i++ {
+			tk.AddN(key(i), float64(100/(i+1)))
+		}
+		for i := 0; i < 50; i++ {
+			tk.Add(key(1000 + round*50 + i))
+		}
+	}
+
+	items := tk.Snapshot()
+	if len(items) != 5 {
+		t.Fatalf("ERROR: expected 5 items but got %d", len(items))
+	}
+	for i, it := range items {
+		if it.Key != string(key(i)) {
+			t.Errorf("ERROR: expected rank %d to be %s but got %s", i, key(i), it.Key)
+		}
+		truth := float64(100 * (100 / (i + 1)))
+		if it.Count < truth || it.Count-it.Error > truth {
+			t.Errorf("ERROR: %s: true count %v is outside [%v, %v]", it.Key, truth, it.Count-it.Error, it.Count)
+		}
+		if !it.Guaranteed {
+			t.Errorf("ERROR: %s: expected a heavy hitter to be guaranteed", it.Key)
+		}
+	}
+
+	tk.Decay(0.5)
+	if decayed := tk.Snapshot(); decayed[0].Count != items[0].Count/2 {
+		t.Errorf("ERROR: expected decay to halve %v but got %v", items[0].Count, decayed[0].Count)
+	}
+}
+
+func TestTopKSmall(t *testing.T) {
+	tk := New(3, 3)
+	for _, k := range []string{"a", "b", "a", "c", "a", "b"} {
+		tk.Add([]byte(k))
+	}
+
+	items := tk.Snapshot()
+	expected := []Item{{"a", 3, 0, true}, {"b", 2, 0, true}, {"c", 1, 0, true}}
+	for i := range expected {
+		if items[i] != expected[i] {
+			t.Errorf("ERROR: expected %v but got %v", expected[i], items[i])
+		}
+	}
+
+	// "d" takes over the smallest counter and inherits its count as error.
+	tk.Add([]byte("d"))
+	items = tk.Snapshot()
+	if last := items[2]; last.Key != "d" || last.Count != 2 || last.Error != 1 || last.Guaranteed {
+		t.Errorf("ERROR: expected d to replace c with count 2 and error 1 but got %v", last)
+	}
+}
+
+func TestTopKEmpty(t *testing.T) {
+	// k and capacity are raised to 1, so the tracker keeps the latest key.
+	tk := New(0, 0)
+	tk.Add([]byte("a"))
+	tk.Add([]byte("b"))
+
+	items := tk.Snapshot()
+	if len(items) != 1 || items[0].Key != "b" || items[0].Count != 2 {
+		t.Errorf("ERROR: expected [b with count 2] but got %v", items)
+	}
+}
@@ -0,0 +1,153 @@
+package cityhash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// Tree hash format version and leaf size. The tag constants are the ASCII
+// strings "cht1leaf", "cht1node" and "cht1root" read as little endian
+// integers.
+const (
+	TreeVersion  = 1
+	TreeLeafSize = 1 << 20
+
+	treeLeafTag uint64 = 0x6661656c31746863
+	treeNodeTag uint64 = 0x65646f6e31746863
+	treeRootTag uint64 = 0x746f6f7231746863
+)
+
+// ErrNegativeSize is returned by CityHashTree128 for a negative size.
+var ErrNegativeSize = fmt.Errorf("cityhash: negative size")
+
+// CityHashTree128 returns the tree hash of the first size bytes of r, hashing
+// leaves on up to workers goroutines (runtime.GOMAXPROCS(0) if workers <= 0).
+//
+// The tree hash is NOT CityHash128 of the input; it is a separate, versioned
+// construction whose result depends only on the input bytes, never on the
+// number of workers. Version 1 is defined as follows. All integers are
+// unsigned 64-bit, all byte encodings are little endian and seeds are written
+// {Lower64, Higher64}.
+//
+//	The input of n bytes is cut into leaves of TreeLeafSize (1 MiB) bytes;
+//	the last leaf may be shorter. An empty input is a single empty leaf.
+//
+//	Leaf i (counting from 0) hashes to
+//	    CityHash128WithSeed(leaf, len(leaf), {i, 0x6661656c31746863})
+//
+//	Nodes are then combined pairwise, left to right, one level at a time.
+//	Level 1 combines leaves, level 2 the results of level 1, and so on.
+//	An odd node at the end of a level moves up unchanged. Two nodes l and r
+//	at level j combine into
+//	    CityHash128WithSeed(l || r, 32, {j, 0x65646f6e31746863})
+//	where l || r is l.Lower64, l.Higher64, r.Lower64, r.Higher64.
+//
+//	When one node t is left, the root is
+//	    CityHash128WithSeed(t || n, 24, {1, 0x746f6f7231746863})
+func CityHashTree128(r io.ReaderAt, size int64, workers int) (Uint128, error) {
+	if size < 0 {
+		return Uint128{}, ErrNegativeSize
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	var count int64 = (size + TreeLeafSize - 1) / TreeLeafSize
+	if count == 0 {
+		count = 1
+	}
+	if int64(workers) > count {
+		workers = int(count)
+	}
+
+	leaves := make([]Uint128, count)
+	jobs := make(chan int64)
+	quit := make(chan struct{})
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buf := make([]byte, TreeLeafSize)
+			for i := range jobs {
+				h, err := treeLeaf(r, size, i, buf)
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(quit)
+					})
+					return
+				}
+				leaves[i] = h
+			}
+		}()
+	}
+
+feed:
+	for i := int64(0); i < count; i++ {
+		select {
+		case jobs <- i:
+		case <-quit:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return Uint128{}, firstErr
+	}
+
+	return treeRoot(leaves, size), nil
+}
+
+func treeLeaf(r io.ReaderAt, size, i int64, buf []byte) (Uint128, error) {
+	var off int64 = i * TreeLeafSize
+	var length int64 = size - off
+	if length > TreeLeafSize {
+		length = TreeLeafSize
+	}
+
+	b := buf[:length]
+	n, err := r.ReadAt(b, off)
+	if n < len(b) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Uint128{}, err
+	}
+
+	return CityHash128WithSeed(b, uint32(length), Uint128{uint64(i), treeLeafTag}), nil
+}
+
+// treeRoot folds the leaf hashes into the root, reusing leaves as scratch.
+func treeRoot(nodes []Uint128, size int64) Uint128 {
+	var buf [32]byte
+
+	for level := uint64(1); len(nodes) > 1; level++ {
+		next := nodes[:0]
+		for i := 0; i < len(nodes); i += 2 {
+			if i+1 == len(nodes) {
+				next = append(next, nodes[i])
+				break
+			}
+
+			copy(buf[:16], nodes[i].Bytes())
+			copy(buf[16:], nodes[i+1].Bytes())
+			next = append(next, CityHash128WithSeed(buf[:], 32, Uint128{level, treeNodeTag}))
+		}
+		nodes = next
+	}
+
+	copy(buf[:16], nodes[0].Bytes())
+	binary.LittleEndian.PutUint64(buf[16:], uint64(size))
+	return CityHash128WithSeed(buf[:24], 24, Uint128{TreeVersion, treeRootTag})
+}
@@ -0,0 +1,57 @@
+package cityhash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// treeReference spells out the version 1 format for three leaves.
+func treeReference(s []byte) Uint128 {
+	node := func(l, r Uint128, level uint64) Uint128 {
+		b := append(l.Bytes(), r.Bytes()...)
+		return CityHash128WithSeed(b, 32, Uint128{level, treeNodeTag})
+	}
+
+	l0 := CityHash128WithSeed(s[:TreeLeafSize], TreeLeafSize, Uint128{0, treeLeafTag})
+	l1 := CityHash128WithSeed(s[TreeLeafSize:2*TreeLeafSize], TreeLeafSize, Uint128{1, treeLeafTag})
+	l2 := CityHash128WithSeed(s[2*TreeLeafSize:], uint32(len(s)-2*TreeLeafSize), Uint128{2, treeLeafTag})
+	top := node(node(l0, l1, 1), l2, 2)
+
+	b := top.Bytes()
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(s)))
+	return CityHash128WithSeed(b, 24, Uint128{TreeVersion, treeRootTag})
+}
+
+func TestCityHashTree128(t *testing.T) {
+	setup()
+
+	s := append(append(append([]byte{}, data[:]...), data[:]...), data[:12345]...)
+	expected := treeReference(s)
+
+	for _, workers := range []int{0, 1, 2, 3, 8} {
+		u, err := CityHashTree128(bytes.NewReader(s), int64(len(s)), workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(expected.Lower64(), u.Lower64(), t)
+		check(expected.Higher64(), u.Higher64(), t)
+	}
+
+	empty, err := CityHashTree128(bytes.NewReader(nil), 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := CityHash128WithSeed(nil, 0, Uint128{0, treeLeafTag})
+	root := CityHash128WithSeed(append(leaf.Bytes(), make([]byte, 8)...), 24, Uint128{TreeVersion, treeRootTag})
+	check(root.Lower64(), empty.Lower64(), t)
+	check(root.Higher64(), empty.Higher64(), t)
+
+	if _, err = CityHashTree128(bytes.NewReader(s), int64(len(s))+1, 4); err != io.ErrUnexpectedEOF {
+		t.Errorf("ERROR: expected io.ErrUnexpectedEOF for a short input but got %v", err)
+	}
+	if _, err = CityHashTree128(bytes.NewReader(s), -5, 4); err != ErrNegativeSize {
+		t.Errorf("ERROR: expected ErrNegativeSize for a negative size but got %v", err)
+	}
+}
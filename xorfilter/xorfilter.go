@@ -0,0 +1,314 @@
+// Package xorfilter builds xor filters (Graf and Lemire, "Xor Filters:
+// Faster and Smaller Than Bloom and Cuckoo Filters") and binary fuse filters
+// (Graf and Lemire, "Binary Fuse Filters: Fast and Smaller Than Xor
+// Filters") with 8-bit fingerprints over static key sets.
+//
+// Keys are hashed with CityHash64WithSeed. Construction retries with the
+// next seed whenever the key set cannot be peeled, so the seed is part of
+// the filter. A filter encodes to a flat blob that Open can query in place,
+// for instance straight from a memory-mapped file.
+package xorfilter
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/zentures/cityhash"
+)
+
+const (
+	kindXor8        = 1
+	kindBinaryFuse8 = 2
+
+	// maxAttempts is how many seeds a build tries before giving up.
+	maxAttempts = 100
+)
+
+var (
+	ErrBuildFailed = errors.New("xorfilter: construction failed")
+	ErrInvalid     = errors.New("xorfilter: invalid encoding")
+)
+
+// Filter is an xor or binary fuse filter. It is safe for concurrent reads.
+type Filter struct {
+	kind         uint8
+	seed         uint64
+	length       uint32 // xor: block length; binary fuse: segment length
+	segmentCount uint32 // binary fuse only
+	fingerprints []byte
+}
+
+func (this *Filter) Seed() uint64 {
+	return this.seed
+}
+
+// hashKeys hashes keys with seed and drops duplicate hashes, which would
+// otherwise make peeling impossible.
+func hashKeys(keys [][]byte, seed uint64, hashes []uint64) []uint64 {
+	hashes = hashes[:0]
+	for _, k := range keys {
+		hashes = append(hashes, cityhash.CityHash64WithSeed(k, uint32(len(k)), seed))
+	}
+
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	n := 0
+	for i, h := range hashes {
+		if i == 0 || h != hashes[n-1] {
+			hashes[n] = h
+			n++
+		}
+	}
+	return hashes[:n]
+}
+
+func fingerprint(h uint64) uint8 {
+	return uint8(h ^ h>>32)
+}
+
+// nextSeed steps a splitmix64 sequence of seeds.
+func nextSeed(seed uint64) uint64 {
+	seed += 0x9e3779b97f4a7c15
+	z := seed
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+func reduce(h uint32, n uint32) uint32 {
+	return uint32(uint64(h) * uint64(n) >> 32)
+}
+
+// locations returns the three fingerprint indexes of a hash.
+func (this *Filter) locations(h uint64) (uint32, uint32, uint32) {
+	if this.kind == kindXor8 {
+		bl := this.length
+		return reduce(uint32(h), bl),
+			reduce(uint32(bits.RotateLeft64(h, 21)), bl) + bl,
+			reduce(uint32(bits.RotateLeft64(h, 42)), bl) + 2*bl
+	}
+
+	hi, _ := bits.Mul64(h, uint64(this.segmentCount)*uint64(this.length))
+	mask := this.length - 1
+	h0 := uint32(hi)
+	h1 := h0 + this.length
+	h2 := h1 + this.length
+	h1 ^= uint32(h>>18) & mask
+	h2 ^= uint32(h) & mask
+	return h0, h1, h2
+}
+
+// Contains reports whether key may be in the set the filter was built from.
+// False means it definitely is not; keys outside the set are reported
+// present with probability about 1/256.
+func (this *Filter) Contains(key []byte) bool {
+	h := cityhash.CityHash64WithSeed(key, uint32(len(key)), this.seed)
+	h0, h1, h2 := this.locations(h)
+	return fingerprint(h)^this.fingerprints[h0]^this.fingerprints[h1]^this.fingerprints[h2] == 0
+}
+
+// BuildXor8 returns an xor filter of keys, using about 9.84 bits per key.
+func BuildXor8(keys [][]byte) (*Filter, error) {
+	return build(keys, kindXor8)
+}
+
+// BuildBinaryFuse8 returns a binary fuse filter of keys, using about 9 bits
+// per key for large sets.
+func BuildBinaryFuse8(keys [][]byte) (*Filter, error) {
+	return build(keys, kindBinaryFuse8)
+}
+
+// newFilter returns an empty filter of the given kind for n distinct keys.
+func newFilter(kind uint8, n int) *Filter {
+	if kind == kindXor8 {
+		capacity := 32 + uint32(math.Ceil(1.23*float64(n)))
+		blockLength := capacity / 3
+
+		return &Filter{
+			kind:         kindXor8,
+			length:       blockLength,
+			fingerprints: make([]byte, 3*blockLength),
+		}
+	}
+
+	// Segment length and size factor as in the reference implementation.
+	segmentLength := uint32(4)
+	if n > 0 {
+		segmentLength = uint32(1) << int(math.Floor(math.Log(float64(n))/math.Log(3.33)+2.25))
+	}
+	if segmentLength > 1<<18 {
+		segmentLength = 1 << 18
+	}
+
+	capacity := 0
+	if n > 1 {
+		sizeFactor := math.Max(1.125, 0.875+0.25*math.Log(1000000)/math.Log(float64(n)))
+		capacity = int(math.Round(float64(n) * sizeFactor))
+	}
+
+	segmentCount := (capacity+int(segmentLength)-1)/int(segmentLength) - 2
+	if segmentCount < 1 {
+		segmentCount = 1
+	}
+
+	return &Filter{
+		kind:         kindBinaryFuse8,
+		length:       segmentLength,
+		segmentCount: uint32(segmentCount),
+		fingerprints: make([]byte, (uint32(segmentCount)+2)*segmentLength),
+	}
+}
+
+// build peels the 3-hypergraph of the hashed keys, trying seeds until it
+// succeeds, and fills in the fingerprints.
+func build(keys [][]byte, kind uint8) (*Filter, error) {
+	seed := nextSeed(0)
+	hashes := hashKeys(keys, seed, nil)
+
+	// Duplicates are gone now, so size the filter for what is left.
+	f := newFilter(kind, len(hashes))
+	size := len(f.fingerprints)
+	counts := make([]uint8, size)
+	xors := make([]uint64, size)
+	queue := make([]uint32, 0, size)
+
+	type peeled struct {
+		h   uint64
+		idx uint32
+	}
+	stack := make([]peeled, 0, len(hashes))
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			seed = nextSeed(seed)
+			hashes = hashKeys(keys, seed, hashes)
+		}
+		f.seed = seed
+
+		for i := range counts {
+			counts[i], xors[i] = 0, 0
+		}
+		overflow := false
+		for _, h := range hashes {
+			h0, h1, h2 := f.locations(h)
+			for _, i := range [3]uint32{h0, h1, h2} {
+				counts[i]++
+				xors[i] ^= h
+				overflow = overflow || counts[i] == 0
+			}
+		}
+		if overflow {
+			continue
+		}
+
+		queue = queue[:0]
+		for i, c := range counts {
+			if c == 1 {
+				queue = append(queue, uint32(i))
+			}
+		}
+
+		stack = stack[:0]
+		for len(queue) > 0 {
+			i := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			if counts[i] != 1 {
+				continue
+			}
+
+			h := xors[i]
+			stack = append(stack, peeled{h, i})
+
+			h0, h1, h2 := f.locations(h)
+			for _, j := range [3]uint32{h0, h1, h2} {
+				counts[j]--
+				xors[j] ^= h
+				if counts[j] == 1 {
+					queue = append(queue, j)
+				}
+			}
+		}
+
+		if len(stack) == len(hashes) {
+			for n := len(stack) - 1; n >= 0; n-- {
+				p := stack[n]
+				h0, h1, h2 := f.locations(p.h)
+				f.fingerprints[p.idx] = 0
+				f.fingerprints[p.idx] = fingerprint(p.h) ^ f.fingerprints[h0] ^ f.fingerprints[h1] ^ f.fingerprints[h2]
+			}
+			return f, nil
+		}
+	}
+
+	return nil, ErrBuildFailed
+}
+
+// The encoding is, little endian throughout:
+//
+//	magic        [4]byte "CHXF"
+//	version      uint8   1
+//	kind         uint8   1 xor, 2 binary fuse
+//	             [2]byte reserved, zero
+//	seed         uint64
+//	length       uint32  xor: block length; binary fuse: segment length
+//	segmentCount uint32  binary fuse only, else zero
+//	fingerprints []byte  xor: 3*length; binary fuse: (segmentCount+2)*length
+const headerSize = 24
+
+var magic = [4]byte{'C', 'H', 'X', 'F'}
+
+func (this *Filter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, headerSize+len(this.fingerprints))
+	b = append(b, magic[:]...)
+	b = append(b, 1, this.kind, 0, 0)
+	b = binary.LittleEndian.AppendUint64(b, this.seed)
+	b = binary.LittleEndian.AppendUint32(b, this.length)
+	b = binary.LittleEndian.AppendUint32(b, this.segmentCount)
+	return append(b, this.fingerprints...), nil
+}
+
+// Open returns a filter backed by b, an encoding made by MarshalBinary. The
+// fingerprints are not copied, so b must not change while the filter is in
+// use.
+func Open(b []byte) (*Filter, error) {
+	if len(b) < headerSize || [4]byte(b[:4]) != magic || b[4] != 1 {
+		return nil, ErrInvalid
+	}
+
+	f := &Filter{
+		kind:         b[5],
+		seed:         binary.LittleEndian.Uint64(b[8:]),
+		length:       binary.LittleEndian.Uint32(b[16:]),
+		segmentCount: binary.LittleEndian.Uint32(b[20:]),
+		fingerprints: b[headerSize:],
+	}
+
+	var size uint64
+	switch f.kind {
+	case kindXor8:
+		size = 3 * uint64(f.length)
+	case kindBinaryFuse8:
+		if f.length == 0 || f.length&(f.length-1) != 0 || f.segmentCount == 0 {
+			return nil, ErrInvalid
+		}
+		size = (uint64(f.segmentCount) + 2) * uint64(f.length)
+	}
+	if size == 0 || uint64(len(f.fingerprints)) != size {
+		return nil, ErrInvalid
+	}
+
+	return f, nil
+}
+
+func (this *Filter) UnmarshalBinary(b []byte) error {
+	f, err := Open(b)
+	if err != nil {
+		return err
+	}
+
+	*this = *f
+	this.fingerprints = append([]byte(nil), f.fingerprints...)
+	return nil
+}
@@ -0,0 +1,83 @@
+package xorfilter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func keys(from, to int) [][]byte {
+	var ks [][]byte
+	for i := from; i < to; i++ {
+		ks = append(ks, []byte(fmt.Sprintf("key-%d", i)))
+	}
+	return ks
+}
+
+func TestBuild(t *testing.T) {
+	builders := map[string]func([][]byte) (*Filter, error){
+		"xor8":        BuildXor8,
+		"binaryfuse8": BuildBinaryFuse8,
+	}
+
+	for name, build := range builders {
+		for _, n := range []int{0, 1, 2, 10, 1000, 100000} {
+			set := keys(0, n)
+			// Duplicates must not break construction.
+			set = append(set, keys(0, n/10)...)
+
+			f, err := build(set)
+			if err != nil {
+				t.Fatalf("ERROR: %s, %d keys: %v", name, n, err)
+			}
+
+			b, err := f.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, err := Open(b)
+			if err != nil {
+				t.Fatalf("ERROR: %s, %d keys: %v", name, n, err)
+			}
+
+			for _, k := range set {
+				if !f.Contains(k) || !g.Contains(k) {
+					t.Fatalf("ERROR: %s, %d keys: false negative for %s", name, n, k)
+				}
+			}
+
+			if n < 1000 {
+				continue
+			}
+			fp := 0
+			others := keys(n, 2*n)
+			for _, k := range others {
+				if g.Contains(k) {
+					fp++
+				}
+			}
+			if rate := float64(fp) / float64(n); rate > 2.0/256 {
+				t.Errorf("ERROR: %s, %d keys: expected a false positive rate near 1/256 but got %v", name, n, rate)
+			}
+			if bpk := float64(8*len(b)) / float64(n); n == 100000 && bpk > 10.5 {
+				t.Errorf("ERROR: %s: expected about 9-10 bits per key but got %.2f", name, bpk)
+			}
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	f, err := BuildBinaryFuse8(keys(0, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := f.MarshalBinary()
+
+	if _, err = Open(b[:len(b)-1]); err != ErrInvalid {
+		t.Errorf("ERROR: expected ErrInvalid for a truncated filter but got %v", err)
+	}
+
+	b[5] = 9
+	if _, err = Open(b); err != ErrInvalid {
+		t.Errorf("ERROR: expected ErrInvalid for an unknown kind but got %v", err)
+	}
+}